@@ -0,0 +1,165 @@
+// Package apperr defines application errors that carry a kind and a stable code, so API clients can tell
+// a bad request, a missing resource or a conflict apart from a real failure.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+type Kind string
+
+const (
+	KindInvalid       Kind = "invalid"
+	KindUnauthorized  Kind = "unauthorized"
+	KindForbidden     Kind = "forbidden"
+	KindNotFound      Kind = "not_found"
+	KindConflict      Kind = "conflict"
+	KindUnprocessable Kind = "unprocessable"
+	KindUnavailable   Kind = "unavailable"
+	KindInternal      Kind = "internal"
+)
+
+func (k Kind) HTTPStatus() int {
+	switch k {
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindUnprocessable:
+		return http.StatusUnprocessableEntity
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeDuplicateKey   = "duplicate_key"
+	CodeNotFound       = "not_found"
+	CodeUnavailable    = "service_unavailable"
+	CodeInternal       = "internal_error"
+)
+
+// Error is an application error. Two errors with the same kind and code are considered the same by errors.Is,
+// so a sentinel error still matches after WithDetails or Wrap.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Details map[string]any
+	Err     error
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Invalid(code string, format string, args ...any) *Error {
+	return New(KindInvalid, code, fmt.Sprintf(format, args...))
+}
+
+func NotFound(code string, format string, args ...any) *Error {
+	return New(KindNotFound, code, fmt.Sprintf(format, args...))
+}
+
+func Forbidden(code string, format string, args ...any) *Error {
+	return New(KindForbidden, code, fmt.Sprintf(format, args...))
+}
+
+func Conflict(code string, format string, args ...any) *Error {
+	return New(KindConflict, code, fmt.Sprintf(format, args...))
+}
+
+func Unprocessable(code string, format string, args ...any) *Error {
+	return New(KindUnprocessable, code, fmt.Sprintf(format, args...))
+}
+
+// NotFoundOr returns a not found error if err is mongo.ErrNoDocuments, e.g. from FindOne. Other errors are wrapped
+// with the message, so they are still classified by From.
+func NotFoundOr(err error, code string, format string, args ...any) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return NotFound(code, format, args...)
+	}
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err)
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// WithDetails returns a copy of the error with an additional detail.
+func (e *Error) WithDetails(key string, value any) *Error {
+	clone := *e
+	clone.Details = make(map[string]any, len(e.Details)+1)
+	for k, v := range e.Details {
+		clone.Details[k] = v
+	}
+	clone.Details[key] = value
+	return &clone
+}
+
+// Wrap returns a copy of the error caused by err.
+func (e *Error) Wrap(err error) *Error {
+	clone := *e
+	clone.Err = err
+	return &clone
+}
+
+// From classifies any error as an application error. An Error in the chain is returned as-is. Otherwise, duplicate keys
+// are conflicts, missing documents are not found, and network failures and timeouts are unavailable. Everything else is internal.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return New(KindConflict, CodeDuplicateKey, "resource already exists").Wrap(err)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return New(KindNotFound, CodeNotFound, "resource is not found").Wrap(err)
+	case isUnavailable(err):
+		return New(KindUnavailable, CodeUnavailable, "service is temporarily unavailable").Wrap(err)
+	default:
+		return New(KindInternal, CodeInternal, "internal server error").Wrap(err)
+	}
+}
+
+func isUnavailable(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var serverSelectionErr topology.ServerSelectionError
+	if errors.As(err, &serverSelectionErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
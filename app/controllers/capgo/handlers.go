@@ -1,21 +1,30 @@
 package capgo
 
 import (
+	"errors"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/db"
 	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func NewCapgoController() *CapgoController {
 	return &CapgoController{
-		updateService: &services.UpdateService{},
+		updateService:  &services.UpdateService{},
+		channelService: &services.ChannelService{},
+		statsService:   &services.StatsService{},
 	}
 }
 
 type CapgoController struct {
-	updateService *services.UpdateService
+	updateService  *services.UpdateService
+	channelService *services.ChannelService
+	statsService   *services.StatsService
 }
 
 func (ctrl *CapgoController) Updates(ctx *gin.Context) {
@@ -39,6 +48,9 @@ func (ctrl *CapgoController) Updates(ctx *gin.Context) {
 			Platform:    reqBody.GetPlatform(),
 			VersionName: reqBody.VersionBuild,
 			VersionCode: reqBody.VersionCode,
+
+			DeviceID:       reqBody.DeviceID,
+			DefaultChannel: reqBody.DefaultChannel,
 		})
 		if err != nil {
 			return CapgoErrorResponse{
@@ -46,32 +58,154 @@ func (ctrl *CapgoController) Updates(ctx *gin.Context) {
 			}, nil
 		}
 
+		if result.BreakingChange != nil {
+			return UpdateBreakingChangeVersionResponse{
+				Message: result.BreakingChange.Message,
+				Major:   true,
+				Version: result.BreakingChange.Version,
+			}, nil
+		}
+
+		downloadURL, err := ctrl.updateService.CreateBundleDownloadURL(ctx.Request.Context(), result.Bundle)
+		if err != nil {
+			return nil, err
+		}
+
 		return UpdateWithNewMinorVersionResponse{
-			Version:   result.VersionName(),
-			Checksum:  result.Checksum(),
-			URL:       result.PublicDownloadURL(),
-			Signature: result.Signature(),
+			Version:    result.VersionName(),
+			Checksum:   result.Checksum(reqBody.PluginVersion),
+			URL:        downloadURL.String(),
+			SessionKey: result.SessionKey(),
+			Signature:  result.Signature(),
 		}, nil
 	})
 }
 
+// DownloadBundle serves a bundle zip file for a signed download url, created in signed download url mode.
+func (ctrl *CapgoController) DownloadBundle(ctx *gin.Context) {
+	bundleID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	r, size, err := ctrl.updateService.OpenSignedBundle(ctx.Request.Context(), bundleID, ctx.Query("expires"), ctx.Query("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBundleDownloadURLInvalid):
+			ctx.AbortWithStatus(http.StatusForbidden)
+		case errors.Is(err, services.ErrBundleNotFound):
+			ctx.AbortWithStatus(http.StatusNotFound)
+		default:
+			slog.Error("Failed to open bundle", "error", err, "bundle", bundleID.Hex())
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+	defer r.Close()
+
+	ctx.Header("Cache-Control", "private, no-store")
+	ctx.DataFromReader(http.StatusOK, size, "application/zip", r, nil)
+}
+
 func (ctrl *CapgoController) Stats(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
-		slog.Info("Capgo - stats", "body", ctx.Request.Body)
-		return gin.H{}, nil
+		var reqBody StatsRequest
+		err := ctx.BindJSON(&reqBody)
+		if err != nil {
+			return CapgoErrorResponse{
+				Error: "invalid request body json",
+			}, nil
+		}
+
+		if !reqBody.IsValid() {
+			return CapgoErrorResponse{
+				Error: "invalid request data",
+			}, nil
+		}
+
+		err = ctrl.statsService.Record(db.StatsEvent{
+			ID:             primitive.NewObjectID(),
+			AppID:          reqBody.AppID,
+			DeviceID:       reqBody.DeviceID,
+			CustomID:       reqBody.CustomID,
+			Platform:       reqBody.GetPlatform(),
+			Action:         reqBody.Action,
+			VersionName:    reqBody.VersionName,
+			OldVersionName: reqBody.OldVersionName,
+			VersionBuild:   reqBody.VersionBuild,
+			VersionCode:    reqBody.VersionCode,
+			VersionOS:      reqBody.VersionOS,
+			PluginVersion:  reqBody.PluginVersion,
+			IsEmulator:     reqBody.IsEmulator,
+			IsProd:         reqBody.IsProd,
+			CreatedAt:      time.Now(),
+		})
+		if err != nil {
+			slog.Warn("Capgo - stats event is dropped", "error", err, "action", reqBody.Action)
+		}
+
+		return CapgoStatusResponse{
+			Status: "ok",
+		}, nil
 	})
 }
 
 func (ctrl *CapgoController) RegisterChannel(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
-		slog.Info("Capgo - register channel", "body", ctx.Request.Body)
-		return gin.H{}, nil
+		var reqBody ChannelSelfRequest
+		err := ctx.BindJSON(&reqBody)
+		if err != nil {
+			return CapgoErrorResponse{
+				Error: "invalid request body json",
+			}, nil
+		}
+
+		if !reqBody.IsValid() || reqBody.Channel == "" {
+			return CapgoErrorResponse{
+				Error: "invalid request data",
+			}, nil
+		}
+
+		err = ctrl.channelService.SetDeviceChannel(ctx.Request.Context(), reqBody.AppID, reqBody.DeviceID, reqBody.Channel)
+		if err != nil {
+			if errors.Is(err, services.ErrChannelNotFound) || errors.Is(err, services.ErrChannelSelfSetNotAllowed) {
+				return CapgoErrorResponse{
+					Error: err.Error(),
+				}, nil
+			}
+			return nil, err
+		}
+
+		return CapgoStatusResponse{
+			Status: "ok",
+		}, nil
 	})
 }
 
 func (ctrl *CapgoController) UnregisterChannel(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
-		slog.Info("Capgo - unregister channel", "body", ctx.Request.Body)
-		return gin.H{}, nil
+		var reqBody ChannelSelfRequest
+		err := ctx.BindJSON(&reqBody)
+		if err != nil {
+			return CapgoErrorResponse{
+				Error: "invalid request body json",
+			}, nil
+		}
+
+		if !reqBody.IsValid() {
+			return CapgoErrorResponse{
+				Error: "invalid request data",
+			}, nil
+		}
+
+		err = ctrl.channelService.UnsetDeviceChannel(ctx.Request.Context(), reqBody.AppID, reqBody.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+
+		return CapgoStatusResponse{
+			Status: "ok",
+		}, nil
 	})
 }
@@ -2,6 +2,7 @@ package capgo
 
 import (
 	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
 )
 
 type UpdateRequest struct {
@@ -37,6 +38,28 @@ func (c *UpdateRequest) GetPlatform() db.Platform {
 	return p
 }
 
+// ChannelSelfRequest is a request from a device to assign (or unassign) itself to a channel.
+// Capgo sends the same device information as the update request, plus the channel name.
+type ChannelSelfRequest struct {
+	UpdateRequest
+	Channel string `json:"channel"`
+}
+
+// StatsRequest is an event reported by Capgo plugin, e.g. set, download_fail, update_fail.
+type StatsRequest struct {
+	UpdateRequest
+	Action         string `json:"action"`
+	OldVersionName string `json:"old_version_name"`
+}
+
+func (c *StatsRequest) IsValid() bool {
+	_, err := db.ParsePlatform(c.Platform)
+	if err != nil {
+		return false
+	}
+	return c.DeviceID != "" && c.AppID != "" && services.IsValidStatsAction(c.Action)
+}
+
 type UpdateWithNewMinorVersionResponse struct {
 	// Version is a new version string. Capgo will download from URL if this version string doesn't equal to current version
 	Version string `json:"version"`
@@ -44,7 +67,7 @@ type UpdateWithNewMinorVersionResponse struct {
 	URL string `json:"url"`
 	// SessionKey is Base64 IV + Cipher AES key. Use for decrypt the bundle (encrypted with private key embedded in the app). Can be empty if not use
 	SessionKey string `json:"sessionKey"`
-	//Checksum is CRC checksum of the bundle
+	//Checksum is CRC32 or SHA-256 checksum of the bundle, depending on the plugin version
 	Checksum string `json:"checksum"`
 	//Signature is a signature of the bundle, signed with SHA512 RSA public key that configured in the app. Can be empty if not use
 	Signature string `json:"signature"`
@@ -54,6 +77,11 @@ type CapgoErrorResponse struct {
 	Error string `json:"error"`
 }
 
+type CapgoStatusResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
 type CapgoIncorrectWithMessageResponse struct {
 	Message string `json:"message"`
 }
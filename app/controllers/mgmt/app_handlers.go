@@ -0,0 +1,262 @@
+package mgmt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (ctrl *CapgoManagementController) ListAllApps(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		filter, err := ctrl.accessibleAppFilter(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cursor, err := db.Collections().Apps().Find(
+			ctx.Request.Context(), filter,
+			options.Find().SetSort(bson.D{{Key: "app_id", Value: 1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch apps: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var apps []db.App
+		if err = cursor.All(ctx.Request.Context(), &apps); err != nil {
+			return nil, fmt.Errorf("failed to decode apps: %w", err)
+		}
+
+		response := make([]AppResponse, len(apps))
+		for i, app := range apps {
+			response[i] = mapAppToResponse(app)
+		}
+
+		return ListAllAppsResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) CreateApp(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req CreateAppRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		principal := authn.GetPrincipal(ctx)
+		orgID := req.GetOrgID()
+		if !principal.Superadmin {
+			if principal.OrgID == nil || !principal.Has(db.PermissionAdmin) {
+				return nil, apperr.Forbidden("permission_denied", "%v permission is required", db.PermissionAdmin)
+			}
+			if orgID != nil && *orgID != *principal.OrgID {
+				return nil, apperr.Forbidden("org_access_denied", "access to organization %v is denied", req.OrgID)
+			}
+			orgID = principal.OrgID
+		}
+		if orgID != nil {
+			if err := db.Collections().Organizations().FindOne(ctx.Request.Context(), bson.M{"_id": *orgID}).Err(); err != nil {
+				return nil, apperr.NotFoundOr(err, "organization_not_found", "failed to find organization id: %v", orgID.Hex())
+			}
+		}
+
+		app := db.App{
+			ID:                   primitive.NewObjectID(),
+			OrgID:                orgID,
+			AppID:                req.AppID,
+			Name:                 req.Name,
+			Platforms:            req.GetPlatforms(),
+			SigningPrivateKey:    req.SigningPrivateKey,
+			EncryptionPrivateKey: req.EncryptionPrivateKey,
+			DefaultChannel:       req.DefaultChannel,
+			UpdatedAt:            time.Now(),
+			CreatedAt:            time.Now(),
+		}
+		if req.Retention != nil {
+			app.Retention = &db.RetentionPolicy{
+				KeepLast: req.Retention.KeepLast,
+				KeepDays: req.Retention.KeepDays,
+			}
+		}
+
+		_, err := db.Collections().Apps().InsertOne(ctx.Request.Context(), app)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, apperr.Conflict("app_already_exists", "app already exists. app id: %v", app.AppID)
+			}
+			return nil, fmt.Errorf("failed to create app: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "apps.create",
+			AppID:   app.AppID,
+			Targets: []db.AuditTarget{appTarget(app)},
+			After:   appSnapshot(app),
+		})
+
+		return gin.H{
+			"message": "App created successfully",
+			"app":     mapAppToResponse(app),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) UpdateApp(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req UpdateAppRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		app, err := ctrl.authorizeApp(ctx, db.PermissionAdmin, req.AppID)
+		if err != nil {
+			return nil, err
+		}
+		before := appSnapshot(app)
+
+		if req.OrgID != nil {
+			if err := requireSuperadmin(ctx); err != nil {
+				return nil, err
+			}
+			app.OrgID = req.GetOrgID()
+		}
+		if req.Name != nil {
+			app.Name = *req.Name
+		}
+		if req.Platforms != nil {
+			app.Platforms = req.GetPlatforms()
+		}
+		if req.SigningPrivateKey != nil {
+			app.SigningPrivateKey = *req.SigningPrivateKey
+		}
+		if req.EncryptionPrivateKey != nil {
+			app.EncryptionPrivateKey = *req.EncryptionPrivateKey
+		}
+		if req.DefaultChannel != nil {
+			app.DefaultChannel = *req.DefaultChannel
+		}
+		if req.Retention != nil {
+			app.Retention = &db.RetentionPolicy{
+				KeepLast: req.Retention.KeepLast,
+				KeepDays: req.Retention.KeepDays,
+			}
+		}
+		app.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Apps().ReplaceOne(ctx.Request.Context(), bson.M{"_id": app.ID}, app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update app: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "apps.update",
+			AppID:   app.AppID,
+			Targets: []db.AuditTarget{appTarget(app)},
+			Before:  before,
+			After:   appSnapshot(app),
+		})
+
+		return gin.H{
+			"message": "App updated successfully",
+			"app":     mapAppToResponse(app),
+		}, nil
+	})
+}
+
+// DeleteApp unregisters an app. An app can only be deleted after its bundles, releases and channels are deleted.
+func (ctrl *CapgoManagementController) DeleteApp(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req DeleteAppRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		app, err := ctrl.authorizeApp(ctx, db.PermissionAdmin, req.AppID)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, coll := range map[string]*mongo.Collection{
+			"bundles":  db.Collections().Bundles(),
+			"releases": db.Collections().Releases(),
+			"channels": db.Collections().Channels(),
+		} {
+			count, err := coll.CountDocuments(ctx.Request.Context(), bson.M{"app_id": req.AppID}, options.Count().SetLimit(1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to count %s: %w", name, err)
+			}
+			if count > 0 {
+				return nil, apperr.Conflict("app_in_use", "app still has %s. app id: %v", name, req.AppID).WithDetails("resource", name)
+			}
+		}
+
+		result, err := db.Collections().Apps().DeleteOne(ctx.Request.Context(), bson.M{"app_id": req.AppID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete app: %w", err)
+		}
+		if result.DeletedCount == 0 {
+			return nil, services.ErrAppNotFound
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "apps.delete",
+			OrgID:   app.OrgID,
+			AppID:   app.AppID,
+			Targets: []db.AuditTarget{appTarget(app)},
+			Before:  appSnapshot(app),
+		})
+
+		return gin.H{
+			"message": "App deleted successfully",
+		}, nil
+	})
+}
+
+func mapAppToResponse(app db.App) AppResponse {
+	platforms := make([]string, len(app.Platforms))
+	for i, p := range app.Platforms {
+		platforms[i] = string(p)
+	}
+	r := AppResponse{
+		ID:               app.ID.Hex(),
+		AppID:            app.AppID,
+		Name:             app.Name,
+		Platforms:        platforms,
+		HasSigningKey:    app.SigningPrivateKey != "",
+		HasEncryptionKey: app.EncryptionPrivateKey != "",
+		DefaultChannel:   app.DefaultChannel,
+		UpdatedAt:        app.UpdatedAt,
+		CreatedAt:        app.CreatedAt,
+	}
+	if app.OrgID != nil {
+		s := app.OrgID.Hex()
+		r.OrgID = &s
+	}
+	if app.Retention != nil {
+		r.Retention = &RetentionPolicyResponse{
+			KeepLast: app.Retention.KeepLast,
+			KeepDays: app.Retention.KeepDays,
+		}
+	}
+	return r
+}
@@ -0,0 +1,197 @@
+package mgmt
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AppResponse struct {
+	ID               string                   `json:"id"`
+	OrgID            *string                  `json:"org_id"`
+	AppID            string                   `json:"app_id"`
+	Name             string                   `json:"name"`
+	Platforms        []string                 `json:"platforms"`
+	HasSigningKey    bool                     `json:"has_signing_key"`
+	HasEncryptionKey bool                     `json:"has_encryption_key"`
+	DefaultChannel   string                   `json:"default_channel"`
+	Retention        *RetentionPolicyResponse `json:"retention"`
+	UpdatedAt        time.Time                `json:"updated_at"`
+	CreatedAt        time.Time                `json:"created_at"`
+}
+
+type RetentionPolicyResponse struct {
+	KeepLast int `json:"keep_last"`
+	KeepDays int `json:"keep_days"`
+}
+
+type ListAllAppsResponse struct {
+	Data []AppResponse `json:"data"`
+}
+
+type RetentionPolicyRequest struct {
+	KeepLast int `json:"keep_last"`
+	KeepDays int `json:"keep_days"`
+}
+
+func (req *RetentionPolicyRequest) IsValid() error {
+	if req.KeepLast < 0 || req.KeepDays < 0 {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "retention keep last and keep days must not be negative")
+	}
+	return nil
+}
+
+// CreateAppRequest registers an app. Private keys must be PEM encoded, and they are never returned by the API.
+// OrgID can only be chosen by superadmins, other callers create apps in their own organization.
+type CreateAppRequest struct {
+	OrgID                string                  `json:"org_id"`
+	AppID                string                  `json:"app_id"`
+	Name                 string                  `json:"name"`
+	Platforms            []string                `json:"platforms"`
+	SigningPrivateKey    string                  `json:"signing_private_key"`
+	EncryptionPrivateKey string                  `json:"encryption_private_key"`
+	DefaultChannel       string                  `json:"default_channel"`
+	Retention            *RetentionPolicyRequest `json:"retention"`
+}
+
+func (req *CreateAppRequest) IsValid() error {
+	if req.AppID == "" || req.Name == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
+	}
+	if !appIDPattern.MatchString(req.AppID) {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid app id: must be dot separated segments of letters, digits, - and _, e.g. com.example.app")
+	}
+	if req.OrgID != "" {
+		if _, err := primitive.ObjectIDFromHex(req.OrgID); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid org id: %v", err)
+		}
+	}
+	if _, err := parsePlatforms(req.Platforms); err != nil {
+		return err
+	}
+	if err := validateAppKeys(req.SigningPrivateKey, req.EncryptionPrivateKey); err != nil {
+		return err
+	}
+	if req.Retention != nil {
+		return req.Retention.IsValid()
+	}
+	return nil
+}
+
+func (req *CreateAppRequest) GetOrgID() *primitive.ObjectID {
+	if req.OrgID == "" {
+		return nil
+	}
+	id, _ := primitive.ObjectIDFromHex(req.OrgID)
+	return &id
+}
+
+func (req *CreateAppRequest) GetPlatforms() []db.Platform {
+	platforms, _ := parsePlatforms(req.Platforms)
+	return platforms
+}
+
+// UpdateAppRequest changes the settings of an app. Nil fields are left unchanged. An empty private key removes
+// the app key, so the server-wide key is used again. OrgID moves the app to another organization, superadmins only.
+type UpdateAppRequest struct {
+	AppID                string                  `json:"app_id"`
+	OrgID                *string                 `json:"org_id"`
+	Name                 *string                 `json:"name"`
+	Platforms            []string                `json:"platforms"`
+	SigningPrivateKey    *string                 `json:"signing_private_key"`
+	EncryptionPrivateKey *string                 `json:"encryption_private_key"`
+	DefaultChannel       *string                 `json:"default_channel"`
+	Retention            *RetentionPolicyRequest `json:"retention"`
+}
+
+func (req *UpdateAppRequest) IsValid() error {
+	if req.AppID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing app id")
+	}
+	if req.Name != nil && *req.Name == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "name is empty")
+	}
+	if req.OrgID != nil && *req.OrgID != "" {
+		if _, err := primitive.ObjectIDFromHex(*req.OrgID); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid org id: %v", err)
+		}
+	}
+	if _, err := parsePlatforms(req.Platforms); err != nil {
+		return err
+	}
+	var signingKey, encryptionKey string
+	if req.SigningPrivateKey != nil {
+		signingKey = *req.SigningPrivateKey
+	}
+	if req.EncryptionPrivateKey != nil {
+		encryptionKey = *req.EncryptionPrivateKey
+	}
+	if err := validateAppKeys(signingKey, encryptionKey); err != nil {
+		return err
+	}
+	if req.Retention != nil {
+		return req.Retention.IsValid()
+	}
+	return nil
+}
+
+// GetOrgID returns the new organization of the app. Nil removes the app from its organization.
+func (req *UpdateAppRequest) GetOrgID() *primitive.ObjectID {
+	if req.OrgID == nil || *req.OrgID == "" {
+		return nil
+	}
+	id, _ := primitive.ObjectIDFromHex(*req.OrgID)
+	return &id
+}
+
+func (req *UpdateAppRequest) GetPlatforms() []db.Platform {
+	platforms, _ := parsePlatforms(req.Platforms)
+	return platforms
+}
+
+type DeleteAppRequest struct {
+	AppID string `json:"app_id"`
+}
+
+func (req *DeleteAppRequest) IsValid() error {
+	if req.AppID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing app id")
+	}
+	return nil
+}
+
+func parsePlatforms(values []string) ([]db.Platform, error) {
+	platforms := make([]db.Platform, 0, len(values))
+	for _, v := range values {
+		p, err := db.ParsePlatform(v)
+		if err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid platform: %v", err)
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, nil
+}
+
+// appIDPattern matches app ids like com.example.app. App ids are used as prefixes of storage keys and in cache keys,
+// so separators like / and empty segments like .. are rejected.
+var appIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// validateAppKeys checks that app keys are inline PEM encoded private keys. Unlike keys of the server config,
+// app keys can't be paths, so callers can't make the server use its own key files.
+func validateAppKeys(signingKey string, encryptionKey string) error {
+	if signingKey != "" {
+		if _, err := services.NewBundleSignerFromPEM(signingKey); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid signing private key: %v", err)
+		}
+	}
+	if encryptionKey != "" {
+		if _, err := services.NewBundleEncryptorFromPEM(encryptionKey); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid encryption private key: %v", err)
+		}
+	}
+	return nil
+}
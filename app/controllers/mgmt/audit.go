@@ -0,0 +1,81 @@
+package mgmt
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/requestid"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// audit records a change made by the caller. The change is already saved, so a failure is only logged instead of
+// failing the request.
+func (ctrl *CapgoManagementController) audit(ctx *gin.Context, event db.AuditEvent) {
+	principal := authn.GetPrincipal(ctx)
+	event.Actor = db.AuditActor{
+		Kind:    principal.Kind,
+		Subject: principal.Subject,
+	}
+	event.RequestID = requestid.Get(ctx)
+	event.ClientIP = ctx.ClientIP()
+
+	if err := ctrl.auditService.Record(ctx.Request.Context(), event); err != nil {
+		slog.Error("Failed to record audit event", "error", err, "action", event.Action, "request_id", event.RequestID)
+	}
+}
+
+func releaseTarget(release db.Release) db.AuditTarget {
+	return db.AuditTarget{Type: db.AuditTargetRelease, ID: release.ID.Hex()}
+}
+
+func bundleTarget(bundle db.Bundle) db.AuditTarget {
+	return db.AuditTarget{Type: db.AuditTargetBundle, ID: bundle.ID.Hex()}
+}
+
+func channelTarget(channel db.Channel) db.AuditTarget {
+	return db.AuditTarget{Type: db.AuditTargetChannel, ID: channel.ID.Hex()}
+}
+
+func appTarget(app db.App) db.AuditTarget {
+	return db.AuditTarget{Type: db.AuditTargetApp, ID: app.AppID}
+}
+
+func webhookTarget(webhook db.Webhook) db.AuditTarget {
+	return db.AuditTarget{Type: db.AuditTargetWebhook, ID: webhook.ID.Hex()}
+}
+
+func webhookDeliveryTarget(delivery db.WebhookDelivery) db.AuditTarget {
+	return db.AuditTarget{Type: db.AuditTargetWebhookDelivery, ID: delivery.ID.Hex()}
+}
+
+// auditRedacted replaces secrets in audit snapshots, so only whether a secret is set is recorded.
+const auditRedacted = "[redacted]"
+
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return auditRedacted
+}
+
+// appSnapshot is an audit snapshot of the app with its private keys redacted.
+func appSnapshot(app db.App) bson.Raw {
+	app.SigningPrivateKey = redactSecret(app.SigningPrivateKey)
+	app.EncryptionPrivateKey = redactSecret(app.EncryptionPrivateKey)
+	return services.AuditSnapshot(app)
+}
+
+// webhookSnapshot is an audit snapshot of the webhook with its secret redacted.
+func webhookSnapshot(webhook db.Webhook) bson.Raw {
+	webhook.Secret = redactSecret(webhook.Secret)
+	return services.AuditSnapshot(webhook)
+}
+
+// apiTokenSnapshot is an audit snapshot of the API token with its hash redacted.
+func apiTokenSnapshot(token db.ApiToken) bson.Raw {
+	token.TokenHash = redactSecret(token.TokenHash)
+	return services.AuditSnapshot(token)
+}
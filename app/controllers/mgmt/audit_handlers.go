@@ -0,0 +1,136 @@
+package mgmt
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultAuditListLimit = 100
+	maxAuditListLimit     = 1000
+)
+
+// ListAuditEvents returns audit events, newest first. Query parameters (all optional): app_id, action, actor (subject),
+// target_id, since and until (RFC3339), and limit. Callers only see events of apps they can read, and organization admins
+// also see events of their organization, e.g. API token changes.
+func (ctrl *CapgoManagementController) ListAuditEvents(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		filter, err := ctrl.accessibleAuditFilter(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions := []bson.M{filter}
+		if s := ctx.Query("app_id"); s != "" {
+			conditions = append(conditions, bson.M{"app_id": s})
+		}
+		if s := ctx.Query("action"); s != "" {
+			conditions = append(conditions, bson.M{"action": s})
+		}
+		if s := ctx.Query("actor"); s != "" {
+			conditions = append(conditions, bson.M{"actor.subject": s})
+		}
+		if s := ctx.Query("target_id"); s != "" {
+			conditions = append(conditions, bson.M{"targets.id": s})
+		}
+		for param, op := range map[string]string{"since": "$gte", "until": "$lt"} {
+			if s := ctx.Query(param); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid %s: %v", param, err)
+				}
+				conditions = append(conditions, bson.M{"created_at": bson.M{op: t}})
+			}
+		}
+
+		limit := defaultAuditListLimit
+		if s := ctx.Query("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit <= 0 || limit > maxAuditListLimit {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "limit must be between 1 and %d", maxAuditListLimit)
+			}
+		}
+
+		cursor, err := db.Collections().AuditEvents().Find(
+			ctx.Request.Context(), bson.M{"$and": conditions},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch audit events: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var events []db.AuditEvent
+		if err = cursor.All(ctx.Request.Context(), &events); err != nil {
+			return nil, fmt.Errorf("failed to decode audit events: %w", err)
+		}
+
+		response := make([]AuditEventResponse, len(events))
+		for i, event := range events {
+			response[i] = mapAuditEventToResponse(event)
+		}
+
+		return ListAuditEventsResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+// accessibleAuditFilter returns a filter of audit events readable by the caller.
+func (ctrl *CapgoManagementController) accessibleAuditFilter(ctx *gin.Context) (bson.M, error) {
+	filter, err := ctrl.accessibleAppFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := authn.GetPrincipal(ctx)
+	if principal.Superadmin || principal.Global {
+		return filter, nil
+	}
+	if principal.Has(db.PermissionAdmin) && len(principal.AppIDs) == 0 {
+		return bson.M{"$or": []bson.M{filter, {"org_id": *principal.OrgID}}}, nil
+	}
+	return filter, nil
+}
+
+func mapAuditEventToResponse(event db.AuditEvent) AuditEventResponse {
+	targets := make([]AuditTargetResponse, len(event.Targets))
+	for i, t := range event.Targets {
+		targets[i] = AuditTargetResponse{
+			Type: string(t.Type),
+			ID:   t.ID,
+		}
+	}
+	r := AuditEventResponse{
+		ID:     event.ID.Hex(),
+		Action: event.Action,
+		Actor: AuditActorResponse{
+			Kind:    event.Actor.Kind,
+			Subject: event.Actor.Subject,
+		},
+		AppID:     event.AppID,
+		Targets:   targets,
+		RequestID: event.RequestID,
+		ClientIP:  event.ClientIP,
+		CreatedAt: event.CreatedAt,
+	}
+	if event.OrgID != nil {
+		s := event.OrgID.Hex()
+		r.OrgID = &s
+	}
+	if event.Before != nil {
+		_ = bson.Unmarshal(event.Before, &r.Before)
+	}
+	if event.After != nil {
+		_ = bson.Unmarshal(event.After, &r.After)
+	}
+	return r
+}
@@ -0,0 +1,33 @@
+package mgmt
+
+import (
+	"time"
+)
+
+type AuditActorResponse struct {
+	Kind    string `json:"kind"`
+	Subject string `json:"subject"`
+}
+
+type AuditTargetResponse struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuditEventResponse struct {
+	ID        string                 `json:"id"`
+	Action    string                 `json:"action"`
+	Actor     AuditActorResponse     `json:"actor"`
+	OrgID     *string                `json:"org_id"`
+	AppID     string                 `json:"app_id"`
+	Targets   []AuditTargetResponse  `json:"targets"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	RequestID string                 `json:"request_id"`
+	ClientIP  string                 `json:"client_ip"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type ListAuditEventsResponse struct {
+	Data []AuditEventResponse `json:"data"`
+}
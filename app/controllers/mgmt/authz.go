@@ -0,0 +1,58 @@
+package mgmt
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// authorizeApp checks that the caller has the permission on the registered app, and returns the app.
+func (ctrl *CapgoManagementController) authorizeApp(ctx *gin.Context, perm db.Permission, appID string) (db.App, error) {
+	app, err := ctrl.appService.FindApp(ctx.Request.Context(), appID)
+	if err != nil {
+		return db.App{}, err
+	}
+	if err := authn.GetPrincipal(ctx).Authorize(perm, app); err != nil {
+		return db.App{}, err
+	}
+	return app, nil
+}
+
+// accessibleAppFilter returns a filter of documents that belong to apps readable by the caller.
+func (ctrl *CapgoManagementController) accessibleAppFilter(ctx *gin.Context) (bson.M, error) {
+	principal := authn.GetPrincipal(ctx)
+	if principal.Superadmin {
+		return bson.M{}, nil
+	}
+	if !principal.Has(db.PermissionRead) {
+		return nil, apperr.Forbidden("permission_denied", "%v permission is required", db.PermissionRead)
+	}
+	if principal.Global {
+		return bson.M{}, nil
+	}
+	if principal.OrgID == nil {
+		return nil, apperr.Forbidden("permission_denied", "organization member is required")
+	}
+
+	filter := bson.M{"org_id": *principal.OrgID}
+	if len(principal.AppIDs) > 0 {
+		filter["app_id"] = bson.M{"$in": principal.AppIDs}
+	}
+	appIDs, err := db.Collections().Apps().Distinct(ctx.Request.Context(), "app_id", filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch accessible apps: %w", err)
+	}
+	return bson.M{"app_id": bson.M{"$in": appIDs}}, nil
+}
+
+// requireSuperadmin checks that the caller is a superadmin, e.g. for managing organizations.
+func requireSuperadmin(ctx *gin.Context) error {
+	if !authn.GetPrincipal(ctx).Superadmin {
+		return apperr.Forbidden("permission_denied", "superadmin is required")
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package mgmt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (ctrl *CapgoManagementController) ListAllChannels(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		filter, err := ctrl.accessibleAppFilter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if appID := ctx.Query("app_id"); appID != "" {
+			filter = bson.M{"$and": bson.A{filter, bson.M{"app_id": appID}}}
+		}
+
+		cursor, err := db.Collections().Channels().Find(
+			ctx.Request.Context(), filter,
+			options.Find().SetSort(bson.D{{Key: "app_id", Value: 1}, {Key: "name", Value: 1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch channels: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var channels []db.Channel
+		if err = cursor.All(ctx.Request.Context(), &channels); err != nil {
+			return nil, fmt.Errorf("failed to decode channels: %w", err)
+		}
+
+		response := make([]ChannelResponse, len(channels))
+		for i, channel := range channels {
+			response[i] = mapChannelToResponse(channel)
+		}
+
+		return ListAllChannelsResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) CreateChannel(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req CreateChannelRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		_, err := ctrl.authorizeApp(ctx, db.PermissionRelease, req.AppID)
+		if err != nil {
+			return nil, err
+		}
+
+		channel := db.Channel{
+			ID:                 primitive.NewObjectID(),
+			AppID:              req.AppID,
+			Name:               req.Name,
+			AllowDeviceSelfSet: req.AllowDeviceSelfSet,
+			Bundles:            []db.ChannelBundle{},
+			UpdatedAt:          time.Now(),
+			CreatedAt:          time.Now(),
+		}
+
+		_, err = db.Collections().Channels().InsertOne(ctx.Request.Context(), channel)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, apperr.Conflict("channel_already_exists", "channel already exists. app id: %v, name: %v", channel.AppID, channel.Name)
+			}
+			return nil, fmt.Errorf("failed to create channel: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "channels.create",
+			AppID:   channel.AppID,
+			Targets: []db.AuditTarget{channelTarget(channel)},
+			After:   services.AuditSnapshot(channel),
+		})
+
+		return gin.H{
+			"message": "Channel created successfully",
+			"channel": mapChannelToResponse(channel),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) UpdateChannel(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req UpdateChannelRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var channel db.Channel
+		err := db.Collections().Channels().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetChannelID()}).Decode(&channel)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "channel_not_found", "failed to find channel id: %v", req.ChannelID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, channel.AppID); err != nil {
+			return nil, err
+		}
+		before := services.AuditSnapshot(channel)
+
+		if req.AllowDeviceSelfSet != nil {
+			channel.AllowDeviceSelfSet = *req.AllowDeviceSelfSet
+		}
+		channel.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Channels().UpdateOne(
+			ctx.Request.Context(),
+			bson.M{"_id": channel.ID},
+			bson.M{"$set": channel},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update channel: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "channels.update",
+			AppID:   channel.AppID,
+			Targets: []db.AuditTarget{channelTarget(channel)},
+			Before:  before,
+			After:   services.AuditSnapshot(channel),
+		})
+
+		return gin.H{
+			"message": "Channel updated successfully",
+			"channel": mapChannelToResponse(channel),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) SetChannelBundle(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req SetChannelBundleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var channel db.Channel
+		err := db.Collections().Channels().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetChannelID()}).Decode(&channel)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "channel_not_found", "failed to find channel id: %v", req.ChannelID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, channel.AppID); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err = db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if release.AppID != channel.AppID {
+			return nil, apperr.Unprocessable("app_mismatch", "release %v does not belong to app %v", req.ReleaseID, channel.AppID)
+		}
+
+		before := services.AuditSnapshot(channel)
+		targets := []db.AuditTarget{channelTarget(channel), releaseTarget(release)}
+		bundles := make([]db.ChannelBundle, 0, len(channel.Bundles)+1)
+		for _, b := range channel.Bundles {
+			if b.ReleaseID != release.ID {
+				bundles = append(bundles, b)
+			}
+		}
+
+		if req.BundleID != "" {
+			var bundle db.Bundle
+			err = db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBundleID(), "deleted_at": nil}).Decode(&bundle)
+			if err != nil {
+				return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", req.BundleID)
+			}
+			if bundle.AppID != channel.AppID {
+				return nil, apperr.Unprocessable("app_mismatch", "bundle %v does not belong to app %v", req.BundleID, channel.AppID)
+			}
+			targets = append(targets, bundleTarget(bundle))
+			bundles = append(bundles, db.ChannelBundle{
+				ReleaseID: release.ID,
+				BundleID:  bundle.ID,
+			})
+		}
+
+		channel.Bundles = bundles
+		channel.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Channels().UpdateOne(
+			ctx.Request.Context(),
+			bson.M{"_id": channel.ID},
+			bson.M{
+				"$set": bson.M{
+					"bundles":    channel.Bundles,
+					"updated_at": channel.UpdatedAt,
+				},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update channel: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "channels.set-bundle",
+			AppID:   channel.AppID,
+			Targets: targets,
+			Before:  before,
+			After:   services.AuditSnapshot(channel),
+		})
+
+		return gin.H{
+			"message": "Channel updated successfully",
+			"channel": mapChannelToResponse(channel),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) DeleteChannel(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req DeleteChannelRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var channel db.Channel
+		err := db.Collections().Channels().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetChannelID()}).Decode(&channel)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "channel_not_found", "failed to find channel id: %v", req.ChannelID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, channel.AppID); err != nil {
+			return nil, err
+		}
+
+		_, err = db.Collections().Channels().DeleteOne(ctx.Request.Context(), bson.M{"_id": channel.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete channel: %w", err)
+		}
+
+		_, err = db.Collections().DeviceChannels().DeleteMany(ctx.Request.Context(), bson.M{
+			"app_id":  channel.AppID,
+			"channel": channel.Name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete device assignments of channel: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "channels.delete",
+			AppID:   channel.AppID,
+			Targets: []db.AuditTarget{channelTarget(channel)},
+			Before:  services.AuditSnapshot(channel),
+		})
+
+		return gin.H{
+			"message": "Channel deleted successfully",
+		}, nil
+	})
+}
+
+func mapChannelToResponse(channel db.Channel) ChannelResponse {
+	bundles := make([]ChannelBundleResponse, len(channel.Bundles))
+	for i, b := range channel.Bundles {
+		bundles[i] = ChannelBundleResponse{
+			ReleaseID: b.ReleaseID.Hex(),
+			BundleID:  b.BundleID.Hex(),
+		}
+	}
+	return ChannelResponse{
+		ID:                 channel.ID.Hex(),
+		AppID:              channel.AppID,
+		Name:               channel.Name,
+		AllowDeviceSelfSet: channel.AllowDeviceSelfSet,
+		Bundles:            bundles,
+		UpdatedAt:          channel.UpdatedAt,
+		CreatedAt:          channel.CreatedAt,
+	}
+}
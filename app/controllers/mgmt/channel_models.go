@@ -0,0 +1,124 @@
+package mgmt
+
+import (
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ChannelResponse struct {
+	ID                 string                  `json:"id"`
+	AppID              string                  `json:"app_id"`
+	Name               string                  `json:"name"`
+	AllowDeviceSelfSet bool                    `json:"allow_device_self_set"`
+	Bundles            []ChannelBundleResponse `json:"bundles"`
+	UpdatedAt          time.Time               `json:"updated_at"`
+	CreatedAt          time.Time               `json:"created_at"`
+}
+
+type ChannelBundleResponse struct {
+	ReleaseID string `json:"release_id"`
+	BundleID  string `json:"bundle_id"`
+}
+
+type ListAllChannelsResponse struct {
+	Data []ChannelResponse `json:"data"`
+}
+
+type CreateChannelRequest struct {
+	AppID              string `json:"app_id"`
+	Name               string `json:"name"`
+	AllowDeviceSelfSet bool   `json:"allow_device_self_set"`
+}
+
+func (req *CreateChannelRequest) IsValid() error {
+	if req.AppID == "" || req.Name == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
+	}
+	return nil
+}
+
+type UpdateChannelRequest struct {
+	ChannelID          string `json:"channel_id"`
+	AllowDeviceSelfSet *bool  `json:"allow_device_self_set"`
+}
+
+func (req *UpdateChannelRequest) IsValid() error {
+	if req.ChannelID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing channel id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ChannelID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid channel id: %v", err)
+	}
+	return nil
+}
+
+func (req *UpdateChannelRequest) GetChannelID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ChannelID)
+	return id
+}
+
+// SetChannelBundleRequest points a channel to a bundle for a release. Empty BundleID removes the release from the channel.
+type SetChannelBundleRequest struct {
+	ChannelID string `json:"channel_id"`
+	ReleaseID string `json:"release_id"`
+	BundleID  string `json:"bundle_id"`
+}
+
+func (req *SetChannelBundleRequest) IsValid() error {
+	if req.ChannelID == "" || req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ChannelID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid channel id: %v", err)
+	}
+	_, err = primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	if req.BundleID != "" {
+		_, err = primitive.ObjectIDFromHex(req.BundleID)
+		if err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid bundle id: %v", err)
+		}
+	}
+	return nil
+}
+
+func (req *SetChannelBundleRequest) GetChannelID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ChannelID)
+	return id
+}
+
+func (req *SetChannelBundleRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
+func (req *SetChannelBundleRequest) GetBundleID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.BundleID)
+	return id
+}
+
+type DeleteChannelRequest struct {
+	ChannelID string `json:"channel_id"`
+}
+
+func (req *DeleteChannelRequest) IsValid() error {
+	if req.ChannelID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing channel id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ChannelID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid channel id: %v", err)
+	}
+	return nil
+}
+
+func (req *DeleteChannelRequest) GetChannelID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ChannelID)
+	return id
+}
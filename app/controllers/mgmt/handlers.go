@@ -1,52 +1,193 @@
 package mgmt
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
 	"mime/multipart"
+	"strconv"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/xid"
+	"github.com/tanapoln/capgo-server/app/apperr"
 	"github.com/tanapoln/capgo-server/app/controllers/utils"
 	"github.com/tanapoln/capgo-server/app/db"
-	"github.com/tanapoln/capgo-server/app/external/s3ext"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/app/services"
 	"github.com/tanapoln/capgo-server/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func NewCapgoManagementController() *CapgoManagementController {
-	return &CapgoManagementController{}
+	return &CapgoManagementController{
+		statsService:    &services.StatsService{},
+		releaseService:  &services.ReleaseService{},
+		bundleService:   &services.BundleService{},
+		appService:      &services.AppService{},
+		apiTokenService: &services.ApiTokenService{},
+		auditService:    &services.AuditService{},
+		webhookService:  &services.WebhookService{},
+	}
 }
 
 type CapgoManagementController struct {
+	statsService    *services.StatsService
+	releaseService  *services.ReleaseService
+	bundleService   *services.BundleService
+	appService      *services.AppService
+	apiTokenService *services.ApiTokenService
+	auditService    *services.AuditService
+	webhookService  *services.WebhookService
 }
 
 func (ctrl *CapgoManagementController) UploadBundle(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
 		var req UploadBundleRequest
 		if err := ctx.Bind(&req); err != nil {
-			return nil, fmt.Errorf("failed to bind request: %v", err)
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
 		}
 		if err := req.IsValid(); err != nil {
 			return nil, err
 		}
 
-		crc, err := calculateCRC(req.Bundle)
+		app, err := ctrl.authorizeApp(ctx, db.PermissionUpload, req.AppID)
+		if err != nil {
+			return nil, err
+		}
+
+		var preEncryption db.BundleEncryption
+		if req.IsPreEncrypted() {
+			preEncryption, err = services.ParseSessionKey(req.SessionKey)
+			if err != nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid session key: %v", err)
+			}
+		}
+
+		report, err := validateBundle(req)
 		if err != nil {
-			return nil, fmt.Errorf("failed to calculate CRC: %v", err)
+			return nil, err
+		}
+		if report.HasErrors() {
+			return nil, apperr.Unprocessable("invalid_bundle", "bundle failed validation: %s", firstValidationError(report)).
+				WithDetails("validation", mapBundleValidationToResponse(report))
 		}
 
-		publicDownloadURL, err := saveFileToS3Public(ctx.Request.Context(), req.VersionName, req.Bundle)
+		sha256Sum, err := calculateSHA256(req.Bundle)
 		if err != nil {
-			return nil, fmt.Errorf("failed to save file: %v", err)
+			return nil, fmt.Errorf("failed to calculate SHA-256: %w", err)
+		}
+
+		// The server signs and encrypts the bundle with the current keys of the app, so an identical bundle must have
+		// been processed with the same keys. A pre-encrypted bundle is processed by the client instead.
+		var signer *services.BundleSigner
+		var encryptor *services.BundleEncryptor
+		var keys *services.BundleKeys
+		if !req.IsPreEncrypted() {
+			signer, err = ctrl.appService.BundleSigner(app)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load bundle signing key: %w", err)
+			}
+			encryptor, err = ctrl.appService.BundleEncryptor(app)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load bundle encryption key: %w", err)
+			}
+			keys = &services.BundleKeys{}
+			if signer != nil {
+				keys.Signing = signer.Fingerprint()
+			}
+			if encryptor != nil {
+				keys.Encryption = encryptor.Fingerprint()
+			}
+		}
+
+		existing, err := ctrl.bundleService.FindByContent(ctx.Request.Context(), req.AppID, sha256Sum, req.VersionName, keys)
+		if err != nil && !errors.Is(err, services.ErrBundleNotFound) {
+			return nil, fmt.Errorf("failed to find identical bundle: %w", err)
+		}
+		// A pre-encrypted bundle is only identical with the same session key, otherwise devices couldn't decrypt it.
+		if err == nil && (!req.IsPreEncrypted() || (existing.Encryption != nil && *existing.Encryption == preEncryption)) {
+			return ctrl.uploadIdenticalBundle(ctx, req, existing, report)
+		}
+
+		var crc, signature string
+		var signedAt *time.Time
+		var encryption *db.BundleEncryption
+		var content io.Reader
+		// storedSum is a SHA-256 of the stored object, which differs from the uploaded file if the server encrypts it.
+		storedSum := sha256Sum
+		sha256Checksum := sha256Sum
+		size := req.Bundle.Size
+
+		if req.IsPreEncrypted() {
+			// The bundle is already encrypted by Capgo CLI, so checksum and signature of the original zip are provided by the client.
+			// Newer Capgo CLI provides a SHA-256 checksum instead of CRC32.
+			encryption = &preEncryption
+			crc = req.Checksum
+			sha256Checksum = ""
+			if services.IsSHA256Checksum(req.Checksum) {
+				sha256Checksum = req.Checksum
+			}
+			signature = req.Signature
+			if signature != "" {
+				now := time.Now()
+				signedAt = &now
+			}
+		} else {
+			var err error
+			crc, err = calculateCRC(req.Bundle)
+			if err != nil {
+				return nil, fmt.Errorf("failed to calculate CRC: %w", err)
+			}
+
+			if signer != nil {
+				signature, err = signBundle(signer, req.Bundle)
+				if err != nil {
+					return nil, fmt.Errorf("failed to sign bundle: %w", err)
+				}
+				now := time.Now()
+				signedAt = &now
+			}
+
+			if encryptor != nil {
+				data, enc, err := encryptBundle(encryptor, req.Bundle)
+				if err != nil {
+					return nil, fmt.Errorf("failed to encrypt bundle: %w", err)
+				}
+				encryption = &enc
+				content = bytes.NewReader(data)
+				storedSum = fmt.Sprintf("%x", sha256.Sum256(data))
+				size = int64(len(data))
+			}
+		}
+
+		if content == nil {
+			f, err := req.Bundle.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file: %w", err)
+			}
+			defer f.Close()
+			content = f
+		}
+
+		contentType := services.BundleContentTypeEncrypted
+		if encryption == nil {
+			contentType, err = detectContentType(req.Bundle)
+			if err != nil {
+				return nil, fmt.Errorf("failed to detect content type: %w", err)
+			}
+		}
+
+		storageKey, publicDownloadURL, err := saveBundleFile(ctx.Request.Context(), bundleStorageKey(req.AppID, storedSum), contentType, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save file: %w", err)
 		}
 
 		bundle := db.Bundle{
@@ -55,36 +196,201 @@ func (ctrl *CapgoManagementController) UploadBundle(ctx *gin.Context) {
 			VersionName:       req.VersionName,
 			Description:       req.Description,
 			CRC:               crc,
+			SHA256:            sha256Sum,
+			SHA256Checksum:    sha256Checksum,
+			Size:              size,
+			ContentType:       contentType,
+			Validation:        &report,
+			Signature:         signature,
+			SignedAt:          signedAt,
+			Encryption:        encryption,
+			StorageKey:        storageKey,
 			PublicDownloadURL: publicDownloadURL,
 			CreatedAt:         time.Now(),
 		}
+		if keys != nil {
+			bundle.SigningKeyFingerprint = keys.Signing
+			bundle.EncryptionKeyFingerprint = keys.Encryption
+		}
 
 		err = saveBundleToDatabase(ctx.Request.Context(), bundle)
 		if err != nil {
-			return nil, fmt.Errorf("failed to save bundle to database: %v", err)
+			return nil, fmt.Errorf("failed to save bundle to database: %w", err)
 		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.webhookService.Dispatch(ctx.Request.Context(), bundle.AppID, db.WebhookEventBundleUploaded, services.NewWebhookBundleData(bundle))
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "bundles.upload",
+			AppID:   bundle.AppID,
+			Targets: []db.AuditTarget{bundleTarget(bundle)},
+			After:   services.AuditSnapshot(bundle),
+		})
 
 		return gin.H{
-			"message": "Bundle uploaded successfully",
-			"bundle":  mapBundleToResponse(bundle),
+			"message":      "Bundle uploaded successfully",
+			"bundle":       mapBundleToResponse(bundle),
+			"deduplicated": false,
 		}, nil
 	})
 }
 
+// uploadIdenticalBundle handles an upload identical to the existing bundle without storing it again. The existing bundle
+// is returned if it has the same version name, otherwise an alias of it is created with the new version name.
+func (ctrl *CapgoManagementController) uploadIdenticalBundle(ctx *gin.Context, req UploadBundleRequest, existing db.Bundle, report db.BundleValidationReport) (interface{}, error) {
+	if existing.VersionName == req.VersionName {
+		return gin.H{
+			"message":      "Identical bundle already exists",
+			"bundle":       mapBundleToResponse(existing),
+			"deduplicated": true,
+		}, nil
+	}
+
+	aliasOf := existing.ID
+	if existing.AliasOf != nil {
+		aliasOf = *existing.AliasOf
+	}
+	bundle := existing
+	bundle.ID = primitive.NewObjectID()
+	bundle.VersionName = req.VersionName
+	bundle.Description = req.Description
+	bundle.AliasOf = &aliasOf
+	bundle.Validation = &report
+	bundle.CreatedAt = time.Now()
+
+	err := saveBundleToDatabase(ctx.Request.Context(), bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save bundle to database: %w", err)
+	}
+	services.InvalidateLatestCache(ctx.Request.Context())
+	ctrl.webhookService.Dispatch(ctx.Request.Context(), bundle.AppID, db.WebhookEventBundleUploaded, services.NewWebhookBundleData(bundle))
+	ctrl.audit(ctx, db.AuditEvent{
+		Action:  "bundles.upload",
+		AppID:   bundle.AppID,
+		Targets: []db.AuditTarget{bundleTarget(bundle), bundleTarget(existing)},
+		After:   services.AuditSnapshot(bundle),
+	})
+
+	return gin.H{
+		"message":      "Bundle uploaded successfully as an alias of an identical bundle",
+		"bundle":       mapBundleToResponse(bundle),
+		"deduplicated": true,
+	}, nil
+}
+
+// ResignBundles signs bundles again with the currently configured signing key, e.g. after key rotation.
+func (ctrl *CapgoManagementController) ResignBundles(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req ResignBundlesRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		filter := bson.M{"deleted_at": nil}
+		if len(req.BundleIDs) > 0 {
+			filter["_id"] = bson.M{"$in": req.GetBundleIDs()}
+		} else {
+			filter["app_id"] = req.AppID
+		}
+
+		cursor, err := db.Collections().Bundles().Find(ctx.Request.Context(), filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch bundles: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var bundles []db.Bundle
+		if err = cursor.All(ctx.Request.Context(), &bundles); err != nil {
+			return nil, fmt.Errorf("failed to decode bundles: %w", err)
+		}
+
+		// Bundles are signed with the key of their app, so signers are loaded once per app.
+		signers := map[string]*services.BundleSigner{}
+		results := make([]ResignBundleResult, len(bundles))
+		for i, bundle := range bundles {
+			results[i] = ResignBundleResult{BundleID: bundle.ID.Hex()}
+
+			signer, ok := signers[bundle.AppID]
+			if !ok {
+				signer, err = ctrl.loadAppBundleSigner(ctx, bundle.AppID)
+				if err != nil {
+					return nil, err
+				}
+				signers[bundle.AppID] = signer
+			}
+			if signer == nil {
+				results[i].Error = "bundle signing key is not configured"
+				continue
+			}
+
+			signature, err := ctrl.bundleService.Resign(ctx.Request.Context(), bundle, signer)
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			results[i].Signature = signature
+			ctrl.audit(ctx, db.AuditEvent{
+				Action:  "bundles.resign",
+				AppID:   bundle.AppID,
+				Targets: []db.AuditTarget{bundleTarget(bundle)},
+				Before:  services.AuditSnapshot(bson.M{"signature": bundle.Signature}),
+				After:   services.AuditSnapshot(bson.M{"signature": signature}),
+			})
+		}
+
+		return ResignBundlesResponse{
+			Data: results,
+		}, nil
+	})
+}
+
+// loadAppBundleSigner authorizes the caller to upload bundles of the app, and returns the bundle signer of the app,
+// or nil if signing is not configured for the app.
+func (ctrl *CapgoManagementController) loadAppBundleSigner(ctx *gin.Context, appID string) (*services.BundleSigner, error) {
+	app, err := ctrl.authorizeApp(ctx, db.PermissionUpload, appID)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ctrl.appService.BundleSigner(app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bundle signing key of app %v: %w", appID, err)
+	}
+	return signer, nil
+}
+
 func (ctrl *CapgoManagementController) CreateRelease(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
 		var req CreateReleaseRequest
 		if err := ctx.ShouldBindJSON(&req); err != nil {
-			return nil, fmt.Errorf("invalid request body: %v", err)
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body: %v", err)
 		}
 		if err := req.IsValid(); err != nil {
 			return nil, err
 		}
 
+		app, err := ctrl.authorizeApp(ctx, db.PermissionRelease, req.AppID)
+		if err != nil {
+			return nil, err
+		}
+		if !app.AllowsPlatform(req.GetPlatform()) {
+			return nil, services.ErrAppPlatformNotAllowed
+		}
+
 		var bundle db.Bundle
-		err := db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBuiltinBundleID()}).Decode(&bundle)
+		err = db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBuiltinBundleID(), "deleted_at": nil}).Decode(&bundle)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch bundle id: %v", req.BuiltinBundleID)
+			return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", req.BuiltinBundleID)
+		}
+		if bundle.AppID != req.AppID {
+			return nil, apperr.Unprocessable("app_mismatch", "bundle %v does not belong to app %v", req.BuiltinBundleID, req.AppID)
+		}
+
+		var targeting *db.ReleaseTargeting
+		if req.Targeting != nil {
+			t := req.Targeting.ToModel()
+			targeting = &t
 		}
 
 		release := db.Release{
@@ -94,14 +400,27 @@ func (ctrl *CapgoManagementController) CreateRelease(ctx *gin.Context) {
 			VersionName:     req.VersionName,
 			VersionCode:     req.VersionCode,
 			BuiltinBundleID: bundle.ID,
+			Targeting:       targeting,
 			UpdatedAt:       time.Now(),
 			CreatedAt:       time.Now(),
 		}
 
 		_, err = db.Collections().Releases().InsertOne(ctx.Request.Context(), release)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create release: %v", err)
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, apperr.Conflict("release_already_exists", "release already exists. app id: %v, platform: %v, version name: %v, version code: %v",
+					release.AppID, release.Platform, release.VersionName, release.VersionCode)
+			}
+			return nil, fmt.Errorf("failed to create release: %w", err)
 		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.webhookService.Dispatch(ctx.Request.Context(), release.AppID, db.WebhookEventReleaseCreated, services.NewWebhookReleaseData(release))
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.create",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release), bundleTarget(bundle)},
+			After:   services.AuditSnapshot(release),
+		})
 
 		return gin.H{
 			"message": "Release created successfully",
@@ -114,7 +433,7 @@ func (ctrl *CapgoManagementController) UpdateRelease(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
 		var req UpdateReleaseRequest
 		if err := ctx.ShouldBindJSON(&req); err != nil {
-			return nil, fmt.Errorf("failed to bind request: %v", err)
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
 		}
 		if err := req.IsValid(); err != nil {
 			return nil, err
@@ -128,25 +447,46 @@ func (ctrl *CapgoManagementController) UpdateRelease(ctx *gin.Context) {
 			},
 		).Decode(&release)
 		if err != nil {
-			return nil, fmt.Errorf("failed to find release id: %v", req.ReleaseID)
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
 		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		before := services.AuditSnapshot(release)
 
+		set := bson.M{"updated_at": time.Now()}
 		if req.ReleaseDate != nil {
-			release.ReleasedDate = req.ReleaseDate
+			set["released_date"] = req.ReleaseDate
 		}
-		release.UpdatedAt = time.Now()
 
+		// Only the updated fields are set, and the update is rejected if the active bundle was changed concurrently,
+		// the same as ReleaseService.SetActiveBundle.
 		result, err := db.Collections().Releases().UpdateOne(
 			ctx.Request.Context(),
-			bson.M{"_id": release.ID},
-			bson.M{"$set": release},
+			bson.M{
+				"_id":              release.ID,
+				"active_bundle_id": release.ActiveBundleID,
+			},
+			bson.M{"$set": set},
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to update release: %v", err)
+			return nil, fmt.Errorf("failed to update release: %w", err)
 		}
-		if result.ModifiedCount == 0 {
-			return nil, fmt.Errorf("failed to update release, no affected. release id: %v", release.ID.Hex())
+		if result.MatchedCount == 0 {
+			return nil, services.ErrReleaseModified
 		}
+		err = db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": release.ID}).Decode(&release)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch updated release: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.update",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release)},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
 
 		return gin.H{
 			"message": "Release updated successfully",
@@ -157,17 +497,35 @@ func (ctrl *CapgoManagementController) UpdateRelease(ctx *gin.Context) {
 
 func (ctrl *CapgoManagementController) ListAllBundles(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
-		cursor, err := db.Collections().Bundles().Find(
-			ctx.Request.Context(), bson.M{},
-			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		filter, err := ctrl.accessibleAppFilter(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch bundles: %v", err)
+			return nil, err
 		}
-		defer cursor.Close(ctx.Request.Context())
 
-		var bundles []db.Bundle
-		if err = cursor.All(ctx.Request.Context(), &bundles); err != nil {
-			return nil, fmt.Errorf("failed to decode bundles: %v", err)
+		q, err := parsePageQuery(ctx, "created_at", "version_name")
+		if err != nil {
+			return nil, err
+		}
+		deleted := false
+		if s := ctx.Query("deleted"); s != "" {
+			if deleted, err = strconv.ParseBool(s); err != nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid deleted: %v", err)
+			}
+		}
+		if deleted {
+			q.conditions = append(q.conditions, bson.M{"deleted_at": bson.M{"$ne": nil}})
+		} else {
+			q.conditions = append(q.conditions, bson.M{"deleted_at": nil})
+		}
+
+		bundles, next, total, err := findPage(ctx.Request.Context(), db.Collections().Bundles(), filter, q, func(b db.Bundle) (interface{}, primitive.ObjectID) {
+			if q.sortField == "version_name" {
+				return b.VersionName, b.ID
+			}
+			return b.CreatedAt, b.ID
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch bundles: %w", err)
 		}
 
 		response := make([]BundleResponse, len(bundles))
@@ -176,24 +534,55 @@ func (ctrl *CapgoManagementController) ListAllBundles(ctx *gin.Context) {
 		}
 
 		return ListAllBundlesResponse{
-			Data: response,
+			Data:       response,
+			NextCursor: next,
+			Total:      total,
 		}, nil
 	})
 }
 
 func (ctrl *CapgoManagementController) ListAllReleases(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
-		cursor, err := db.Collections().Releases().Find(
-			ctx.Request.Context(), bson.M{},
-			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		filter, err := ctrl.accessibleAppFilter(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch bundles: %v", err)
+			return nil, err
 		}
-		defer cursor.Close(ctx.Request.Context())
 
-		var releases []db.Release
-		if err = cursor.All(ctx.Request.Context(), &releases); err != nil {
-			return nil, fmt.Errorf("failed to decode bundles: %v", err)
+		q, err := parsePageQuery(ctx, "created_at", "version_name", "updated_at")
+		if err != nil {
+			return nil, err
+		}
+		if s := ctx.Query("platform"); s != "" {
+			platform, err := db.ParsePlatform(s)
+			if err != nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "%v", err)
+			}
+			q.conditions = append(q.conditions, bson.M{"platform": platform})
+		}
+		if s := ctx.Query("has_active_bundle"); s != "" {
+			hasActive, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid has_active_bundle: %v", err)
+			}
+			if hasActive {
+				q.conditions = append(q.conditions, bson.M{"active_bundle_id": bson.M{"$ne": nil}})
+			} else {
+				q.conditions = append(q.conditions, bson.M{"active_bundle_id": nil})
+			}
+		}
+
+		releases, next, total, err := findPage(ctx.Request.Context(), db.Collections().Releases(), filter, q, func(r db.Release) (interface{}, primitive.ObjectID) {
+			switch q.sortField {
+			case "version_name":
+				return r.VersionName, r.ID
+			case "updated_at":
+				return r.UpdatedAt, r.ID
+			default:
+				return r.CreatedAt, r.ID
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch releases: %w", err)
 		}
 
 		response := make([]ReleaseResponse, len(releases))
@@ -202,7 +591,268 @@ func (ctrl *CapgoManagementController) ListAllReleases(ctx *gin.Context) {
 		}
 
 		return ListAllReleasesResponse{
-			Data: response,
+			Data:       response,
+			NextCursor: next,
+			Total:      total,
+		}, nil
+	})
+}
+
+// DeleteBundle marks a bundle as deleted. It's purged with its stored object after BUNDLE_DELETE_RETENTION,
+// and can be restored until then.
+func (ctrl *CapgoManagementController) DeleteBundle(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req DeleteBundleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var bundle db.Bundle
+		err := db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBundleID()}).Decode(&bundle)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", req.BundleID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, bundle.AppID); err != nil {
+			return nil, err
+		}
+
+		deleted, refs, err := ctrl.bundleService.Delete(ctx.Request.Context(), bundle, req.Force)
+		if err != nil {
+			return nil, err
+		}
+
+		targets := []db.AuditTarget{bundleTarget(bundle)}
+		for _, release := range refs.Active {
+			targets = append(targets, releaseTarget(release))
+		}
+		for _, channel := range refs.Channels {
+			targets = append(targets, channelTarget(channel))
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "bundles.delete",
+			AppID:   bundle.AppID,
+			Targets: targets,
+			Before:  services.AuditSnapshot(bundle),
+			After:   services.AuditSnapshot(deleted),
+		})
+
+		return gin.H{
+			"message": "Bundle deleted successfully",
+			"bundle":  mapBundleToResponse(deleted),
+		}, nil
+	})
+}
+
+// RestoreBundle undoes the deletion of a bundle that's not purged yet.
+func (ctrl *CapgoManagementController) RestoreBundle(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req RestoreBundleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var bundle db.Bundle
+		err := db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBundleID()}).Decode(&bundle)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", req.BundleID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, bundle.AppID); err != nil {
+			return nil, err
+		}
+
+		restored, err := ctrl.bundleService.Restore(ctx.Request.Context(), bundle)
+		if err != nil {
+			return nil, err
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "bundles.restore",
+			AppID:   bundle.AppID,
+			Targets: []db.AuditTarget{bundleTarget(bundle)},
+			Before:  services.AuditSnapshot(bundle),
+			After:   services.AuditSnapshot(restored),
+		})
+
+		return gin.H{
+			"message": "Bundle restored successfully",
+			"bundle":  mapBundleToResponse(restored),
+		}, nil
+	})
+}
+
+// GetBundle returns a bundle with every release using it as the builtin, active, rollout or channel bundle.
+// Query parameters: bundle_id (required).
+func (ctrl *CapgoManagementController) GetBundle(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		if err := validateObjectID("bundle id", ctx.Query("bundle_id")); err != nil {
+			return nil, err
+		}
+		bundleID, _ := primitive.ObjectIDFromHex(ctx.Query("bundle_id"))
+
+		var bundle db.Bundle
+		err := db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": bundleID}).Decode(&bundle)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", bundleID.Hex())
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRead, bundle.AppID); err != nil {
+			return nil, err
+		}
+
+		cursor, err := db.Collections().Channels().Find(ctx.Request.Context(), bson.M{"bundles.bundle_id": bundle.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch channels: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var channels []db.Channel
+		if err = cursor.All(ctx.Request.Context(), &channels); err != nil {
+			return nil, fmt.Errorf("failed to decode channels: %w", err)
+		}
+
+		channelsByRelease := map[primitive.ObjectID][]string{}
+		for _, channel := range channels {
+			for _, b := range channel.Bundles {
+				if b.BundleID == bundle.ID {
+					channelsByRelease[b.ReleaseID] = append(channelsByRelease[b.ReleaseID], channel.Name)
+				}
+			}
+		}
+		channelReleaseIDs := make([]primitive.ObjectID, 0, len(channelsByRelease))
+		for id := range channelsByRelease {
+			channelReleaseIDs = append(channelReleaseIDs, id)
+		}
+
+		cursor, err = db.Collections().Releases().Find(
+			ctx.Request.Context(),
+			bson.M{"$or": []bson.M{
+				{"builtin_bundle_id": bundle.ID},
+				{"active_bundle_id": bundle.ID},
+				{"rollout.bundle_id": bundle.ID},
+				{"rollout.fallback_bundle_id": bundle.ID},
+				{"_id": bson.M{"$in": channelReleaseIDs}},
+			}},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch releases: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var releases []db.Release
+		if err = cursor.All(ctx.Request.Context(), &releases); err != nil {
+			return nil, fmt.Errorf("failed to decode releases: %w", err)
+		}
+
+		usages := make([]BundleReleaseUsageResponse, 0, len(releases))
+		for _, release := range releases {
+			usage := BundleReleaseUsageResponse{
+				Release:  mapReleaseToResponse(release),
+				Usages:   []string{},
+				Channels: channelsByRelease[release.ID],
+			}
+			if release.BuiltinBundleID == bundle.ID {
+				usage.Usages = append(usage.Usages, "builtin")
+			}
+			if release.ActiveBundleID != nil && *release.ActiveBundleID == bundle.ID {
+				usage.Usages = append(usage.Usages, "active")
+			}
+			if release.Rollout.IsRunning() && release.Rollout.BundleID == bundle.ID {
+				usage.Usages = append(usage.Usages, "rollout")
+			}
+			if release.Rollout.IsRunning() && release.Rollout.FallbackBundleID == bundle.ID {
+				usage.Usages = append(usage.Usages, "rollout_fallback")
+			}
+			if len(usage.Channels) > 0 {
+				usage.Usages = append(usage.Usages, "channel")
+			} else {
+				usage.Channels = []string{}
+			}
+			// A finished rollout keeps its bundle ids, which doesn't make the release use the bundle.
+			if len(usage.Usages) > 0 {
+				usages = append(usages, usage)
+			}
+		}
+
+		return BundleDetailResponse{
+			BundleResponse: mapBundleToResponse(bundle),
+			Releases:       usages,
+		}, nil
+	})
+}
+
+// GetRelease returns a release with its builtin and active bundles, and the history of its active bundle.
+// Query parameters: release_id (required).
+func (ctrl *CapgoManagementController) GetRelease(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		if err := validateObjectID("release id", ctx.Query("release_id")); err != nil {
+			return nil, err
+		}
+		releaseID, _ := primitive.ObjectIDFromHex(ctx.Query("release_id"))
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": releaseID}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", releaseID.Hex())
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRead, release.AppID); err != nil {
+			return nil, err
+		}
+
+		bundleIDs := []primitive.ObjectID{release.BuiltinBundleID}
+		if release.ActiveBundleID != nil {
+			bundleIDs = append(bundleIDs, *release.ActiveBundleID)
+		}
+		for _, change := range release.ActiveBundleHistory {
+			if change.BundleID != nil {
+				bundleIDs = append(bundleIDs, *change.BundleID)
+			}
+		}
+
+		cursor, err := db.Collections().Bundles().Find(ctx.Request.Context(), bson.M{"_id": bson.M{"$in": bundleIDs}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch bundles: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var bundles []db.Bundle
+		if err = cursor.All(ctx.Request.Context(), &bundles); err != nil {
+			return nil, fmt.Errorf("failed to decode bundles: %w", err)
+		}
+		bundlesByID := map[primitive.ObjectID]BundleResponse{}
+		for _, bundle := range bundles {
+			bundlesByID[bundle.ID] = mapBundleToResponse(bundle)
+		}
+		bundleOf := func(id *primitive.ObjectID) *BundleResponse {
+			if id == nil {
+				return nil
+			}
+			if b, ok := bundlesByID[*id]; ok {
+				return &b
+			}
+			return nil
+		}
+
+		history := make([]ReleaseBundleHistoryResponse, len(release.ActiveBundleHistory))
+		for i, change := range release.ActiveBundleHistory {
+			history[i] = ReleaseBundleHistoryResponse{
+				Bundle: bundleOf(change.BundleID),
+				At:     change.At,
+			}
+			if change.BundleID != nil {
+				s := change.BundleID.Hex()
+				history[i].BundleID = &s
+			}
+		}
+
+		return ReleaseDetailResponse{
+			ReleaseResponse: mapReleaseToResponse(release),
+			BuiltinBundle:   bundleOf(&release.BuiltinBundleID),
+			ActiveBundle:    bundleOf(release.ActiveBundleID),
+			BundleHistory:   history,
 		}, nil
 	})
 }
@@ -211,7 +861,7 @@ func (ctrl *CapgoManagementController) SetReleaseActiveBundle(ctx *gin.Context)
 	utils.Handle(ctx, func() (interface{}, error) {
 		var req SetReleaseActiveBundleRequest
 		if err := ctx.ShouldBindJSON(&req); err != nil {
-			return nil, fmt.Errorf("failed to bind request: %v", err)
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
 		}
 
 		if err := req.IsValid(); err != nil {
@@ -219,36 +869,261 @@ func (ctrl *CapgoManagementController) SetReleaseActiveBundle(ctx *gin.Context)
 		}
 
 		var bundle db.Bundle
-		err := db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBundleID()}).Decode(&bundle)
+		err := db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBundleID(), "deleted_at": nil}).Decode(&bundle)
 		if err != nil {
-			return nil, fmt.Errorf("failed to find bundle id: %v", req.BundleID)
+			return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", req.BundleID)
 		}
 
 		var release db.Release
 		err = db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
 		if err != nil {
-			return nil, fmt.Errorf("failed to find release id: %v", req.ReleaseID)
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		if release.Rollout.IsRunning() {
+			return nil, apperr.Conflict("rollout_running", "release has a running rollout, advance or abort the rollout instead. release id: %v", req.ReleaseID)
+		}
+		if bundle.AppID != release.AppID {
+			return nil, apperr.Unprocessable("app_mismatch", "bundle %v does not belong to app %v", req.BundleID, release.AppID)
 		}
 
-		result, err := db.Collections().Releases().UpdateOne(
+		updated, err := ctrl.releaseService.SetActiveBundle(ctx.Request.Context(), release, &bundle.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update release: %w", err)
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.set-active",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release), bundleTarget(bundle)},
+			Before:  services.AuditSnapshot(release),
+			After:   services.AuditSnapshot(updated),
+		})
+
+		return gin.H{
+			"message": "Release updated successfully",
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) SetReleaseAutoRollback(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req SetReleaseAutoRollbackRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		before := services.AuditSnapshot(release)
+
+		release.AutoRollback = &db.AutoRollbackPolicy{
+			Enabled:              req.Enabled,
+			FailureRateThreshold: req.FailureRateThreshold,
+			MinEvents:            req.MinEvents,
+		}
+		release.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Releases().UpdateOne(
+			ctx.Request.Context(),
+			bson.M{"_id": release.ID},
+			bson.M{
+				"$set": bson.M{
+					"auto_rollback": release.AutoRollback,
+					"updated_at":    release.UpdatedAt,
+				},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update release: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.set-auto-rollback",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release)},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Release updated successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+// SetReleaseTargeting changes which native builds the release matches, in addition to its exact version name and version code.
+func (ctrl *CapgoManagementController) SetReleaseTargeting(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req SetReleaseTargetingRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		before := services.AuditSnapshot(release)
+
+		release.Targeting = nil
+		if req.Targeting != nil {
+			targeting := req.Targeting.ToModel()
+			release.Targeting = &targeting
+		}
+		release.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Releases().UpdateOne(
+			ctx.Request.Context(),
+			bson.M{"_id": release.ID},
+			bson.M{
+				"$set": bson.M{
+					"targeting":  release.Targeting,
+					"updated_at": release.UpdatedAt,
+				},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update release: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.set-targeting",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release)},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Release updated successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+// SupersedeRelease marks the release as replaced by a newer native version. Devices of the release are asked
+// to update the app from the app store instead of receiving a bundle.
+func (ctrl *CapgoManagementController) SupersedeRelease(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req SupersedeReleaseRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		before := services.AuditSnapshot(release)
+
+		release.Superseded = &db.ReleaseSupersede{
+			Version: req.Version,
+			Message: req.Message,
+			At:      time.Now(),
+		}
+		release.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Releases().UpdateOne(
 			ctx.Request.Context(),
 			bson.M{"_id": release.ID},
 			bson.M{
 				"$set": bson.M{
-					"active_bundle_id": bundle.ID,
-					"updated_at":       time.Now(),
+					"superseded": release.Superseded,
+					"updated_at": release.UpdatedAt,
 				},
 			},
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to update release: %v", err)
+			return nil, fmt.Errorf("failed to update release: %w", err)
 		}
-		if result.ModifiedCount == 0 {
-			return nil, fmt.Errorf("failed to update release, no affected. release id: %v", release.ID.Hex())
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.supersede",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release)},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Release updated successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) UnsupersedeRelease(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req UnsupersedeReleaseRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
 		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		before := services.AuditSnapshot(release)
+
+		release.Superseded = nil
+		release.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Releases().UpdateOne(
+			ctx.Request.Context(),
+			bson.M{"_id": release.ID},
+			bson.M{
+				"$set":   bson.M{"updated_at": release.UpdatedAt},
+				"$unset": bson.M{"superseded": ""},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update release: %w", err)
+		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.unsupersede",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release)},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
 
 		return gin.H{
 			"message": "Release updated successfully",
+			"release": mapReleaseToResponse(release),
 		}, nil
 	})
 }
@@ -257,19 +1132,36 @@ func (ctrl *CapgoManagementController) DeleteRelease(ctx *gin.Context) {
 	utils.Handle(ctx, func() (interface{}, error) {
 		var req DeleteReleaseRequest
 		if err := ctx.ShouldBindJSON(&req); err != nil {
-			return nil, fmt.Errorf("failed to bind request: %v", err)
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
 		}
 		if err := req.IsValid(); err != nil {
 			return nil, err
 		}
 
-		result, err := db.Collections().Releases().DeleteOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()})
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+
+		result, err := db.Collections().Releases().DeleteOne(ctx.Request.Context(), bson.M{"_id": release.ID})
 		if err != nil {
-			return nil, fmt.Errorf("failed to delete release: %v", err)
+			return nil, fmt.Errorf("failed to delete release: %w", err)
 		}
 		if result.DeletedCount == 0 {
-			return nil, fmt.Errorf("failed to delete release, no affected. release id: %v", req.ReleaseID)
+			return nil, apperr.NotFound("release_not_found", "failed to delete release, no affected. release id: %v", req.ReleaseID)
 		}
+		services.InvalidateLatestCache(ctx.Request.Context())
+		ctrl.webhookService.Dispatch(ctx.Request.Context(), release.AppID, db.WebhookEventReleaseDeleted, services.NewWebhookReleaseData(release))
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "releases.delete",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release)},
+			Before:  services.AuditSnapshot(release),
+		})
 
 		return gin.H{
 			"message": "Release deleted successfully",
@@ -277,38 +1169,114 @@ func (ctrl *CapgoManagementController) DeleteRelease(ctx *gin.Context) {
 	})
 }
 
-// Placeholder functions (implement these according to your actual storage and database setup)
-func saveFileToS3Public(ctx context.Context, versionName string, file *multipart.FileHeader) (string, error) {
-	filename := versionName + "_" + xid.New().String() + ".zip"
+// saveBundleFile stores the bundle in the bundle storage under the key and returns the key. In public download url mode,
+// the public url of the object is returned as well.
+func saveBundleFile(ctx context.Context, key string, contentType string, r io.Reader) (string, string, error) {
+	st, err := storage.Default()
+	if err != nil {
+		return "", "", err
+	}
+	if err := st.Put(ctx, key, r, contentType); err != nil {
+		return "", "", fmt.Errorf("failed to upload file: %w", err)
+	}
 
+	if config.Get().BundleDownloadURLMode != services.BundleDownloadURLModePublic {
+		return key, "", nil
+	}
+	publicDownloadURL, err := st.DownloadURL(ctx, key, config.Get().BundleDownloadURLTTL)
+	if err != nil && !errors.Is(err, storage.ErrDownloadURLNotSupported) {
+		return "", "", fmt.Errorf("failed to get public url: %w", err)
+	}
+	return key, publicDownloadURL, nil
+}
+
+func signBundle(signer *services.BundleSigner, file *multipart.FileHeader) (string, error) {
 	r, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer r.Close()
 
-	uploader := s3ext.NewUploader()
-	result, err := uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(config.Get().S3Bucket),
-		Key:    aws.String(fmt.Sprintf("%s/%s", time.Now().Format("2006-01"), filename)),
-		Body:   r,
-		ACL:    types.ObjectCannedACLPublicRead,
-		Metadata: map[string]string{
-			"Content-Type": "application/zip",
-		},
-	})
+	return signer.Sign(r)
+}
+
+func encryptBundle(encryptor *services.BundleEncryptor, file *multipart.FileHeader) ([]byte, db.BundleEncryption, error) {
+	r, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %v", err)
+		return nil, db.BundleEncryption{}, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer r.Close()
+
+	return encryptor.Encrypt(r)
+}
+
+// validateBundle validates the uploaded bundle zip file. A bundle encrypted by Capgo CLI can't be inspected, so only its size is validated.
+func validateBundle(req UploadBundleRequest) (db.BundleValidationReport, error) {
+	validator := services.NewBundleValidatorFromConfig()
+	if req.IsPreEncrypted() {
+		return validator.ValidateEncrypted(req.Bundle.Size), nil
+	}
+
+	f, err := req.Bundle.Open()
+	if err != nil {
+		return db.BundleValidationReport{}, apperr.Unprocessable("invalid_bundle_zip", "invalid bundle zip file: %v", err)
+	}
+	defer f.Close()
+
+	report, err := validator.Validate(f, req.Bundle.Size)
+	if err != nil {
+		return report, apperr.Unprocessable("invalid_bundle_zip", "invalid bundle zip file: %v", err)
+	}
+	return report, nil
+}
+
+func firstValidationError(report db.BundleValidationReport) string {
+	for _, issue := range report.Issues {
+		if issue.Severity != db.BundleValidationError {
+			continue
+		}
+		if issue.Path != "" {
+			return issue.Path + ": " + issue.Message
+		}
+		return issue.Message
+	}
+	return ""
+}
+
+// bundleStorageKey derives the object key of a bundle from the SHA-256 of the stored object, so identical objects
+// of an app share a key.
+func bundleStorageKey(appID string, sha256Sum string) string {
+	return fmt.Sprintf("%s/%s.zip", appID, sha256Sum)
+}
+
+func calculateSHA256(file *multipart.FileHeader) (string, error) {
+	r, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func detectContentType(file *multipart.FileHeader) (string, error) {
+	r, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer r.Close()
 
-	// Return the public URL of the uploaded file
-	return result.Location, nil
+	return services.DetectBundleContentType(r)
 }
 
 func calculateCRC(file *multipart.FileHeader) (string, error) {
 	r, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer r.Close()
 
@@ -333,14 +1301,53 @@ func saveBundleToDatabase(ctx context.Context, bundle db.Bundle) error {
 }
 
 func mapBundleToResponse(bundle db.Bundle) BundleResponse {
-	return BundleResponse{
+	r := BundleResponse{
 		ID:                bundle.ID.Hex(),
 		AppID:             bundle.AppID,
 		VersionName:       bundle.VersionName,
 		Description:       bundle.Description,
 		CRC:               bundle.CRC,
+		SHA256:            bundle.SHA256,
+		SHA256Checksum:    bundle.SHA256Checksum,
+		Size:              bundle.Size,
+		ContentType:       bundle.ContentType,
+		Signature:         bundle.Signature,
+		SignedAt:          bundle.SignedAt,
+		Encrypted:         bundle.Encryption != nil,
 		PublicDownloadURL: bundle.PublicDownloadURL,
 		CreatedAt:         bundle.CreatedAt,
+		DeletedAt:         bundle.DeletedAt,
+	}
+	if bundle.Validation != nil {
+		v := mapBundleValidationToResponse(*bundle.Validation)
+		r.Validation = &v
+	}
+	if bundle.AliasOf != nil {
+		s := bundle.AliasOf.Hex()
+		r.AliasOf = &s
+	}
+	return r
+}
+
+func mapBundleValidationToResponse(report db.BundleValidationReport) BundleValidationResponse {
+	issues := make([]BundleValidationIssueResponse, len(report.Issues))
+	for i, issue := range report.Issues {
+		issues[i] = BundleValidationIssueResponse{
+			Check:    issue.Check,
+			Severity: string(issue.Severity),
+			Path:     issue.Path,
+			Message:  issue.Message,
+		}
+	}
+	return BundleValidationResponse{
+		Inspected:        report.Inspected,
+		Files:            report.Files,
+		CompressedSize:   report.CompressedSize,
+		UncompressedSize: report.UncompressedSize,
+		Issues:           issues,
+		Errors:           report.Errors,
+		Truncated:        report.Truncated,
+		ValidatedAt:      report.ValidatedAt,
 	}
 }
 
@@ -362,5 +1369,50 @@ func mapReleaseToResponse(release db.Release) ReleaseResponse {
 		s := release.ActiveBundleID.Hex()
 		r.ActiveBundleID = &s
 	}
+	if release.Targeting != nil {
+		r.Targeting = &ReleaseTargetingResponse{
+			VersionRange:   release.Targeting.VersionRange,
+			MinVersionCode: release.Targeting.MinVersionCode,
+			MaxVersionCode: release.Targeting.MaxVersionCode,
+		}
+	}
+	if release.Superseded != nil {
+		r.Superseded = &ReleaseSupersedeResponse{
+			Version: release.Superseded.Version,
+			Message: release.Superseded.Message,
+			At:      release.Superseded.At,
+		}
+	}
+	if release.AutoRollback != nil {
+		r.AutoRollback = &AutoRollbackPolicyResponse{
+			Enabled:              release.AutoRollback.Enabled,
+			FailureRateThreshold: release.AutoRollback.FailureRateThreshold,
+			MinEvents:            release.AutoRollback.MinEvents,
+		}
+	}
+	if release.LastRollback != nil {
+		r.LastRollback = &RollbackRecordResponse{
+			FromBundleID: release.LastRollback.FromBundleID.Hex(),
+			FailureRate:  release.LastRollback.FailureRate,
+			Failures:     release.LastRollback.Failures,
+			Sets:         release.LastRollback.Sets,
+			Reason:       release.LastRollback.Reason,
+			At:           release.LastRollback.At,
+		}
+		if release.LastRollback.ToBundleID != nil {
+			s := release.LastRollback.ToBundleID.Hex()
+			r.LastRollback.ToBundleID = &s
+		}
+	}
+	if release.Rollout != nil {
+		r.Rollout = &RolloutResponse{
+			BundleID:         release.Rollout.BundleID.Hex(),
+			FallbackBundleID: release.Rollout.FallbackBundleID.Hex(),
+			Percentage:       release.Rollout.Percentage,
+			Status:           string(release.Rollout.Status),
+			StartedAt:        release.Rollout.StartedAt,
+			UpdatedAt:        release.Rollout.UpdatedAt,
+		}
+	}
 	return r
 }
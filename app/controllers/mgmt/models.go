@@ -1,12 +1,12 @@
 package mgmt
 
 import (
-	"archive/zip"
-	"fmt"
 	"mime/multipart"
 	"time"
 
+	"github.com/tanapoln/capgo-server/app/apperr"
 	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -15,65 +15,237 @@ type UploadBundleRequest struct {
 	AppID       string                `form:"app_id"`
 	VersionName string                `form:"version_name"`
 	Description string                `form:"description"`
+
+	// SessionKey is set when the bundle is already encrypted by Capgo CLI. Checksum is required and Signature is optional,
+	// both are of the original zip file.
+	SessionKey string `form:"session_key"`
+	Checksum   string `form:"checksum"`
+	Signature  string `form:"signature"`
+}
+
+func (req *UploadBundleRequest) IsPreEncrypted() bool {
+	return req.SessionKey != ""
 }
 
 func (req *UploadBundleRequest) IsValid() error {
 	b := req.Bundle != nil && req.VersionName != "" && req.AppID != ""
 	if !b {
-		return fmt.Errorf("invalid request body")
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
 	}
 
-	err := req.validateBundleZip()
-	if err != nil {
-		return err
+	if req.IsPreEncrypted() {
+		if req.Checksum == "" {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "checksum is required for an encrypted bundle")
+		}
+		return nil
 	}
 	return nil
 }
 
-func (req *UploadBundleRequest) validateBundleZip() error {
-	f, err := req.Bundle.Open()
-	if err != nil {
-		return fmt.Errorf("invalid bundle zip file: %v", err)
-	}
-	defer f.Close()
+type BundleResponse struct {
+	ID                string     `json:"id"`
+	AppID             string     `json:"app_id"`
+	VersionName       string     `json:"version_name"`
+	Description       string     `json:"description"`
+	CRC               string     `json:"crc_checksum"`
+	SHA256            string     `json:"sha256"`
+	SHA256Checksum    string     `json:"sha256_checksum"`
+	Size              int64      `json:"size"`
+	ContentType       string     `json:"content_type"`
+	AliasOf           *string    `json:"alias_of"`
+	Signature         string     `json:"signature"`
+	SignedAt          *time.Time `json:"signed_at"`
+	Encrypted         bool       `json:"encrypted"`
+	PublicDownloadURL string     `json:"public_download_url"`
+	CreatedAt         time.Time  `json:"created_at"`
+	DeletedAt         *time.Time `json:"deleted_at"`
+	// Validation is a report of validating the bundle on upload. Nil if the bundle was uploaded before validation.
+	Validation *BundleValidationResponse `json:"validation"`
+}
 
-	_, err = zip.NewReader(f, req.Bundle.Size)
-	if err != nil {
-		return fmt.Errorf("invalid bundle zip file: %v", err)
-	}
+type BundleValidationResponse struct {
+	Inspected        bool                            `json:"inspected"`
+	Files            int                             `json:"files"`
+	CompressedSize   int64                           `json:"compressed_size"`
+	UncompressedSize int64                           `json:"uncompressed_size"`
+	Issues           []BundleValidationIssueResponse `json:"issues"`
+	Errors           int                             `json:"errors"`
+	Truncated        bool                            `json:"truncated"`
+	ValidatedAt      time.Time                       `json:"validated_at"`
+}
 
-	return nil
+type BundleValidationIssueResponse struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
 }
 
-type BundleResponse struct {
-	ID                string    `json:"id"`
-	AppID             string    `json:"app_id"`
-	VersionName       string    `json:"version_name"`
-	Description       string    `json:"description"`
-	CRC               string    `json:"crc_checksum"`
-	PublicDownloadURL string    `json:"public_download_url"`
-	CreatedAt         time.Time `json:"created_at"`
+// BundleDetailResponse is a bundle with every release currently using it.
+type BundleDetailResponse struct {
+	BundleResponse
+	Releases []BundleReleaseUsageResponse `json:"releases"`
+}
+
+type BundleReleaseUsageResponse struct {
+	Release ReleaseResponse `json:"release"`
+	// Usages are how the release uses the bundle: builtin, active, rollout, rollout_fallback or channel.
+	Usages []string `json:"usages"`
+	// Channels are names of channels that pin the bundle for the release.
+	Channels []string `json:"channels"`
 }
 
 type ListAllBundlesResponse struct {
 	Data []BundleResponse `json:"data"`
+	// NextCursor is the cursor of the next page. Nil on the last page.
+	NextCursor *string `json:"next_cursor"`
+	// Total is the number of bundles matching the filters, regardless of the page.
+	Total int64 `json:"total"`
+}
+
+// ResignBundlesRequest selects bundles to be signed again, either by ids or every bundle of an app.
+type ResignBundlesRequest struct {
+	BundleIDs []string `json:"bundle_ids"`
+	AppID     string   `json:"app_id"`
+}
+
+func (req *ResignBundlesRequest) IsValid() error {
+	if len(req.BundleIDs) == 0 && req.AppID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "either bundle ids or app id is required")
+	}
+	for _, id := range req.BundleIDs {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid bundle id: %v", err)
+		}
+	}
+	return nil
+}
+
+func (req *ResignBundlesRequest) GetBundleIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, len(req.BundleIDs))
+	for i, s := range req.BundleIDs {
+		ids[i], _ = primitive.ObjectIDFromHex(s)
+	}
+	return ids
+}
+
+// DeleteBundleRequest deletes a bundle. Force detaches the bundle from releases using it as the active bundle and
+// from channels pinning it.
+type DeleteBundleRequest struct {
+	BundleID string `json:"bundle_id"`
+	Force    bool   `json:"force"`
+}
+
+func (req *DeleteBundleRequest) IsValid() error {
+	return validateObjectID("bundle id", req.BundleID)
+}
+
+func (req *DeleteBundleRequest) GetBundleID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.BundleID)
+	return id
+}
+
+type RestoreBundleRequest struct {
+	BundleID string `json:"bundle_id"`
+}
+
+func (req *RestoreBundleRequest) IsValid() error {
+	return validateObjectID("bundle id", req.BundleID)
+}
+
+func (req *RestoreBundleRequest) GetBundleID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.BundleID)
+	return id
+}
+
+type ResignBundleResult struct {
+	BundleID  string `json:"bundle_id"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ResignBundlesResponse struct {
+	Data []ResignBundleResult `json:"data"`
 }
 
 type ReleaseResponse struct {
-	ID              string     `json:"id"`
-	AppID           string     `json:"app_id"`
-	Platform        string     `json:"platform"`
-	VersionName     string     `json:"version_name"`
-	VersionCode     string     `json:"version_code"`
-	ReleaseDate     *time.Time `json:"release_date"`
-	BuiltinBundleID string     `json:"builtin_bundle_id"`
-	ActiveBundleID  *string    `json:"active_bundle_id"`
-	UpdatedAt       time.Time  `json:"updated_at"`
-	CreatedAt       time.Time  `json:"created_at"`
+	ID              string                      `json:"id"`
+	AppID           string                      `json:"app_id"`
+	Platform        string                      `json:"platform"`
+	VersionName     string                      `json:"version_name"`
+	VersionCode     string                      `json:"version_code"`
+	ReleaseDate     *time.Time                  `json:"release_date"`
+	BuiltinBundleID string                      `json:"builtin_bundle_id"`
+	ActiveBundleID  *string                     `json:"active_bundle_id"`
+	Targeting       *ReleaseTargetingResponse   `json:"targeting"`
+	Rollout         *RolloutResponse            `json:"rollout"`
+	Superseded      *ReleaseSupersedeResponse   `json:"superseded"`
+	AutoRollback    *AutoRollbackPolicyResponse `json:"auto_rollback"`
+	LastRollback    *RollbackRecordResponse     `json:"last_rollback"`
+	UpdatedAt       time.Time                   `json:"updated_at"`
+	CreatedAt       time.Time                   `json:"created_at"`
+}
+
+type ReleaseTargetingResponse struct {
+	VersionRange   string `json:"version_range"`
+	MinVersionCode *int64 `json:"min_version_code"`
+	MaxVersionCode *int64 `json:"max_version_code"`
+}
+
+type ReleaseSupersedeResponse struct {
+	Version string    `json:"version"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+type AutoRollbackPolicyResponse struct {
+	Enabled              bool    `json:"enabled"`
+	FailureRateThreshold float64 `json:"failure_rate_threshold"`
+	MinEvents            int64   `json:"min_events"`
+}
+
+type RollbackRecordResponse struct {
+	FromBundleID string    `json:"from_bundle_id"`
+	ToBundleID   *string   `json:"to_bundle_id"`
+	FailureRate  float64   `json:"failure_rate"`
+	Failures     int64     `json:"failures"`
+	Sets         int64     `json:"sets"`
+	Reason       string    `json:"reason"`
+	At           time.Time `json:"at"`
+}
+
+// ReleaseDetailResponse is a release with its builtin and active bundles, and the history of its active bundle.
+type ReleaseDetailResponse struct {
+	ReleaseResponse
+	BuiltinBundle *BundleResponse                `json:"builtin_bundle"`
+	ActiveBundle  *BundleResponse                `json:"active_bundle"`
+	BundleHistory []ReleaseBundleHistoryResponse `json:"bundle_history"`
+}
+
+type ReleaseBundleHistoryResponse struct {
+	// BundleID is nil when the release was reverted to its builtin bundle.
+	BundleID *string `json:"bundle_id"`
+	// Bundle is nil when the release was reverted to its builtin bundle, or the bundle is deleted.
+	Bundle *BundleResponse `json:"bundle"`
+	At     time.Time       `json:"at"`
 }
 
 type ListAllReleasesResponse struct {
 	Data []ReleaseResponse `json:"data"`
+	// NextCursor is the cursor of the next page. Nil on the last page.
+	NextCursor *string `json:"next_cursor"`
+	// Total is the number of releases matching the filters, regardless of the page.
+	Total int64 `json:"total"`
+}
+
+func validateObjectID(name string, val string) error {
+	if val == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing %s", name)
+	}
+	if _, err := primitive.ObjectIDFromHex(val); err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid %s: %v", name, err)
+	}
+	return nil
 }
 
 type SetReleaseActiveBundleRequest struct {
@@ -83,15 +255,15 @@ type SetReleaseActiveBundleRequest struct {
 
 func (s *SetReleaseActiveBundleRequest) IsValid() error {
 	if s.ReleaseID == "" || s.BundleID == "" {
-		return fmt.Errorf("invalid request body")
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
 	}
 	_, err := primitive.ObjectIDFromHex(s.ReleaseID)
 	if err != nil {
-		return fmt.Errorf("invalid release id: %v", err)
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
 	}
 	_, err = primitive.ObjectIDFromHex(s.BundleID)
 	if err != nil {
-		return fmt.Errorf("invalid bundle id: %v", err)
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid bundle id: %v", err)
 	}
 	return nil
 }
@@ -112,19 +284,25 @@ type CreateReleaseRequest struct {
 	VersionName     string `json:"version_name"`
 	VersionCode     string `json:"version_code"`
 	BuiltinBundleID string `json:"builtin_bundle_id"`
+
+	// Targeting is optional. It lets the release match other native builds than its exact version name and version code.
+	Targeting *ReleaseTargetingRequest `json:"targeting"`
 }
 
 func (req *CreateReleaseRequest) IsValid() error {
 	if _, err := db.ParsePlatform(req.Platform); err != nil {
-		return fmt.Errorf("invalid platform: %v", err)
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid platform: %v", err)
 	}
 	_, err := primitive.ObjectIDFromHex(req.BuiltinBundleID)
 	if err != nil {
-		return fmt.Errorf("invalid builtin bundle id: %v", err)
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid builtin bundle id: %v", err)
 	}
 	b := req.AppID != "" && req.VersionName != "" && req.VersionCode != "" && req.BuiltinBundleID != ""
 	if !b {
-		return fmt.Errorf("invalid request body")
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
+	}
+	if req.Targeting != nil {
+		return services.ValidateReleaseTargeting(req.Targeting.ToModel())
 	}
 	return nil
 }
@@ -146,15 +324,15 @@ type UpdateReleaseRequest struct {
 
 func (req *UpdateReleaseRequest) IsValid() error {
 	if req.ReleaseID == "" {
-		return fmt.Errorf("missing release id")
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
 	}
 	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
 	if err != nil {
-		return fmt.Errorf("invalid release id: %v", err)
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
 	}
 	if req.ReleaseDate != nil {
 		if req.ReleaseDate.IsZero() {
-			return fmt.Errorf("release date is empty")
+			return apperr.Invalid(apperr.CodeInvalidRequest, "release date is empty")
 		}
 	}
 	return nil
@@ -165,17 +343,131 @@ func (req *UpdateReleaseRequest) GetReleaseID() primitive.ObjectID {
 	return id
 }
 
+type SetReleaseAutoRollbackRequest struct {
+	ReleaseID            string  `json:"release_id"`
+	Enabled              bool    `json:"enabled"`
+	FailureRateThreshold float64 `json:"failure_rate_threshold"`
+	MinEvents            int64   `json:"min_events"`
+}
+
+func (req *SetReleaseAutoRollbackRequest) IsValid() error {
+	if req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	if req.FailureRateThreshold <= 0 || req.FailureRateThreshold >= 1 {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "failure rate threshold must be between 0 and 1")
+	}
+	if req.MinEvents < 0 {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "min events must not be negative")
+	}
+	return nil
+}
+
+func (req *SetReleaseAutoRollbackRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
+type ReleaseTargetingRequest struct {
+	VersionRange   string `json:"version_range"`
+	MinVersionCode *int64 `json:"min_version_code"`
+	MaxVersionCode *int64 `json:"max_version_code"`
+}
+
+func (req *ReleaseTargetingRequest) ToModel() db.ReleaseTargeting {
+	return db.ReleaseTargeting{
+		VersionRange:   req.VersionRange,
+		MinVersionCode: req.MinVersionCode,
+		MaxVersionCode: req.MaxVersionCode,
+	}
+}
+
+// SetReleaseTargetingRequest replaces the targeting rule of the release. Nil targeting removes the rule,
+// so the release only matches its exact native build again.
+type SetReleaseTargetingRequest struct {
+	ReleaseID string                   `json:"release_id"`
+	Targeting *ReleaseTargetingRequest `json:"targeting"`
+}
+
+func (req *SetReleaseTargetingRequest) IsValid() error {
+	if req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	if req.Targeting != nil {
+		return services.ValidateReleaseTargeting(req.Targeting.ToModel())
+	}
+	return nil
+}
+
+func (req *SetReleaseTargetingRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
+type SupersedeReleaseRequest struct {
+	ReleaseID string `json:"release_id"`
+	Version   string `json:"version"`
+	Message   string `json:"message"`
+}
+
+func (req *SupersedeReleaseRequest) IsValid() error {
+	if req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	if req.Version == "" || req.Message == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "version and message are required")
+	}
+	return nil
+}
+
+func (req *SupersedeReleaseRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
+type UnsupersedeReleaseRequest struct {
+	ReleaseID string `json:"release_id"`
+}
+
+func (req *UnsupersedeReleaseRequest) IsValid() error {
+	if req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	return nil
+}
+
+func (req *UnsupersedeReleaseRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
 type DeleteReleaseRequest struct {
 	ReleaseID string `json:"release_id"`
 }
 
 func (req *DeleteReleaseRequest) IsValid() error {
 	if req.ReleaseID == "" {
-		return fmt.Errorf("missing release id")
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
 	}
 	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
 	if err != nil {
-		return fmt.Errorf("invalid release id: %v", err)
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
 	}
 	return nil
 }
@@ -0,0 +1,336 @@
+package mgmt
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListAllOrganizations returns every organization for superadmins, or the organization of the caller.
+func (ctrl *CapgoManagementController) ListAllOrganizations(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		principal := authn.GetPrincipal(ctx)
+		filter := bson.M{}
+		if !principal.Superadmin {
+			if principal.OrgID == nil {
+				return nil, apperr.Forbidden("permission_denied", "organization member is required")
+			}
+			filter["_id"] = *principal.OrgID
+		}
+
+		cursor, err := db.Collections().Organizations().Find(
+			ctx.Request.Context(), filter,
+			options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch organizations: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var orgs []db.Organization
+		if err = cursor.All(ctx.Request.Context(), &orgs); err != nil {
+			return nil, fmt.Errorf("failed to decode organizations: %w", err)
+		}
+
+		response := make([]OrganizationResponse, len(orgs))
+		for i, org := range orgs {
+			response[i] = mapOrganizationToResponse(org)
+		}
+
+		return ListAllOrganizationsResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) CreateOrganization(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		if err := requireSuperadmin(ctx); err != nil {
+			return nil, err
+		}
+
+		var req CreateOrganizationRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		org := db.Organization{
+			ID:        primitive.NewObjectID(),
+			Name:      req.Name,
+			UpdatedAt: time.Now(),
+			CreatedAt: time.Now(),
+		}
+		_, err := db.Collections().Organizations().InsertOne(ctx.Request.Context(), org)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create organization: %w", err)
+		}
+
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "organizations.create",
+			OrgID:   &org.ID,
+			Targets: []db.AuditTarget{{Type: db.AuditTargetOrganization, ID: org.ID.Hex()}},
+			After:   services.AuditSnapshot(org),
+		})
+
+		return gin.H{
+			"message":      "Organization created successfully",
+			"organization": mapOrganizationToResponse(org),
+		}, nil
+	})
+}
+
+// DeleteOrganization deletes an organization without apps. API tokens of the organization are deleted as well.
+func (ctrl *CapgoManagementController) DeleteOrganization(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		if err := requireSuperadmin(ctx); err != nil {
+			return nil, err
+		}
+
+		var req DeleteOrganizationRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		count, err := db.Collections().Apps().CountDocuments(ctx.Request.Context(), bson.M{"org_id": req.GetOrgID()}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to count apps: %w", err)
+		}
+		if count > 0 {
+			return nil, apperr.Conflict("organization_in_use", "organization still has apps. org id: %v", req.OrgID)
+		}
+
+		result, err := db.Collections().Organizations().DeleteOne(ctx.Request.Context(), bson.M{"_id": req.GetOrgID()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete organization: %w", err)
+		}
+		if result.DeletedCount == 0 {
+			return nil, services.ErrOrganizationNotFound
+		}
+
+		_, err = db.Collections().ApiTokens().DeleteMany(ctx.Request.Context(), bson.M{"org_id": req.GetOrgID()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete api tokens of organization: %w", err)
+		}
+
+		orgID := req.GetOrgID()
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "organizations.delete",
+			OrgID:   &orgID,
+			Targets: []db.AuditTarget{{Type: db.AuditTargetOrganization, ID: req.OrgID}},
+		})
+
+		return gin.H{
+			"message": "Organization deleted successfully",
+		}, nil
+	})
+}
+
+// ListAllApiTokens returns API tokens of the organization of the caller. Superadmins can filter by org_id query parameter.
+func (ctrl *CapgoManagementController) ListAllApiTokens(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		principal := authn.GetPrincipal(ctx)
+		filter := bson.M{}
+		if principal.Superadmin {
+			if s := ctx.Query("org_id"); s != "" {
+				orgID, err := primitive.ObjectIDFromHex(s)
+				if err != nil {
+					return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid org id: %v", err)
+				}
+				filter["org_id"] = orgID
+			}
+		} else {
+			if principal.OrgID == nil || !principal.Has(db.PermissionAdmin) {
+				return nil, apperr.Forbidden("permission_denied", "%v permission is required", db.PermissionAdmin)
+			}
+			filter["org_id"] = *principal.OrgID
+		}
+
+		cursor, err := db.Collections().ApiTokens().Find(
+			ctx.Request.Context(), filter,
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch api tokens: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var tokens []db.ApiToken
+		if err = cursor.All(ctx.Request.Context(), &tokens); err != nil {
+			return nil, fmt.Errorf("failed to decode api tokens: %w", err)
+		}
+
+		response := make([]ApiTokenResponse, len(tokens))
+		for i, token := range tokens {
+			response[i] = mapApiTokenToResponse(token)
+		}
+
+		return ListAllApiTokensResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+// CreateApiToken creates an API token. The token is only returned in this response. A caller can't create a token
+// with a wider app scope than its own.
+func (ctrl *CapgoManagementController) CreateApiToken(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req CreateApiTokenRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		principal := authn.GetPrincipal(ctx)
+		orgID := req.GetOrgID()
+		if principal.Superadmin {
+			if orgID == nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "missing org id")
+			}
+		} else {
+			if principal.OrgID == nil || !principal.Has(db.PermissionAdmin) {
+				return nil, apperr.Forbidden("permission_denied", "%v permission is required", db.PermissionAdmin)
+			}
+			if orgID != nil && *orgID != *principal.OrgID {
+				return nil, apperr.Forbidden("org_access_denied", "access to organization %v is denied", req.OrgID)
+			}
+			orgID = principal.OrgID
+			if len(principal.AppIDs) > 0 && len(req.AppIDs) == 0 {
+				return nil, apperr.Forbidden("app_access_denied", "app ids are required for a token created by an app scoped token")
+			}
+		}
+
+		err := db.Collections().Organizations().FindOne(ctx.Request.Context(), bson.M{"_id": *orgID}).Err()
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "organization_not_found", "failed to find organization id: %v", orgID.Hex())
+		}
+
+		for _, appID := range req.AppIDs {
+			app, err := ctrl.appService.FindApp(ctx.Request.Context(), appID)
+			if err != nil {
+				return nil, err
+			}
+			if app.OrgID == nil || *app.OrgID != *orgID {
+				return nil, apperr.Unprocessable("app_mismatch", "app %v does not belong to organization %v", appID, orgID.Hex())
+			}
+			if !principal.Superadmin && len(principal.AppIDs) > 0 && !slices.Contains(principal.AppIDs, appID) {
+				return nil, apperr.Forbidden("app_access_denied", "access to app %v is denied", appID)
+			}
+		}
+
+		token, plain, err := ctrl.apiTokenService.CreateToken(ctx.Request.Context(), db.ApiToken{
+			OrgID:       *orgID,
+			Name:        req.Name,
+			AppIDs:      req.AppIDs,
+			Permissions: req.GetPermissions(),
+			ExpiresAt:   req.ExpiresAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create api token: %w", err)
+		}
+
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "tokens.create",
+			OrgID:   &token.OrgID,
+			Targets: []db.AuditTarget{{Type: db.AuditTargetApiToken, ID: token.ID.Hex()}},
+			After:   apiTokenSnapshot(token),
+		})
+
+		return gin.H{
+			"message":   "API token created successfully",
+			"token":     plain,
+			"api_token": mapApiTokenToResponse(token),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) RevokeApiToken(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req RevokeApiTokenRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var token db.ApiToken
+		err := db.Collections().ApiTokens().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetTokenID()}).Decode(&token)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "api_token_not_found", "failed to find token id: %v", req.TokenID)
+		}
+
+		principal := authn.GetPrincipal(ctx)
+		if !principal.CanAccessOrg(token.OrgID) || !principal.Has(db.PermissionAdmin) {
+			return nil, apperr.Forbidden("permission_denied", "%v permission is required", db.PermissionAdmin)
+		}
+		// An app scoped token can only revoke tokens within its apps, the same as it can only create them.
+		if !principal.Superadmin && len(principal.AppIDs) > 0 {
+			if len(token.AppIDs) == 0 {
+				return nil, apperr.Forbidden("app_access_denied", "an organization wide token can't be revoked by an app scoped token")
+			}
+			for _, appID := range token.AppIDs {
+				if !slices.Contains(principal.AppIDs, appID) {
+					return nil, apperr.Forbidden("app_access_denied", "access to app %v is denied", appID)
+				}
+			}
+		}
+
+		_, err = db.Collections().ApiTokens().DeleteOne(ctx.Request.Context(), bson.M{"_id": token.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke api token: %w", err)
+		}
+
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "tokens.revoke",
+			OrgID:   &token.OrgID,
+			Targets: []db.AuditTarget{{Type: db.AuditTargetApiToken, ID: token.ID.Hex()}},
+			Before:  apiTokenSnapshot(token),
+		})
+
+		return gin.H{
+			"message": "API token revoked successfully",
+		}, nil
+	})
+}
+
+func mapOrganizationToResponse(org db.Organization) OrganizationResponse {
+	return OrganizationResponse{
+		ID:        org.ID.Hex(),
+		Name:      org.Name,
+		UpdatedAt: org.UpdatedAt,
+		CreatedAt: org.CreatedAt,
+	}
+}
+
+func mapApiTokenToResponse(token db.ApiToken) ApiTokenResponse {
+	permissions := make([]string, len(token.Permissions))
+	for i, p := range token.Permissions {
+		permissions[i] = string(p)
+	}
+	return ApiTokenResponse{
+		ID:          token.ID.Hex(),
+		OrgID:       token.OrgID.Hex(),
+		Name:        token.Name,
+		Prefix:      token.Prefix,
+		AppIDs:      token.AppIDs,
+		Permissions: permissions,
+		ExpiresAt:   token.ExpiresAt,
+		CreatedAt:   token.CreatedAt,
+	}
+}
@@ -0,0 +1,132 @@
+package mgmt
+
+import (
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrganizationResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListAllOrganizationsResponse struct {
+	Data []OrganizationResponse `json:"data"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *CreateOrganizationRequest) IsValid() error {
+	if req.Name == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
+	}
+	return nil
+}
+
+type DeleteOrganizationRequest struct {
+	OrgID string `json:"org_id"`
+}
+
+func (req *DeleteOrganizationRequest) IsValid() error {
+	if req.OrgID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing org id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.OrgID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid org id: %v", err)
+	}
+	return nil
+}
+
+func (req *DeleteOrganizationRequest) GetOrgID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.OrgID)
+	return id
+}
+
+type ApiTokenResponse struct {
+	ID          string     `json:"id"`
+	OrgID       string     `json:"org_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	AppIDs      []string   `json:"app_ids"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type ListAllApiTokensResponse struct {
+	Data []ApiTokenResponse `json:"data"`
+}
+
+// CreateApiTokenRequest creates an API token of an organization. OrgID is required for superadmins,
+// other callers create tokens of their own organization.
+type CreateApiTokenRequest struct {
+	OrgID       string     `json:"org_id"`
+	Name        string     `json:"name"`
+	AppIDs      []string   `json:"app_ids"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+func (req *CreateApiTokenRequest) IsValid() error {
+	if req.Name == "" || len(req.Permissions) == 0 {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "name and permissions are required")
+	}
+	if req.OrgID != "" {
+		if _, err := primitive.ObjectIDFromHex(req.OrgID); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid org id: %v", err)
+		}
+	}
+	for _, p := range req.Permissions {
+		if _, err := db.ParsePermission(p); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "%v", err)
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "expires at must be in the future")
+	}
+	return nil
+}
+
+func (req *CreateApiTokenRequest) GetOrgID() *primitive.ObjectID {
+	if req.OrgID == "" {
+		return nil
+	}
+	id, _ := primitive.ObjectIDFromHex(req.OrgID)
+	return &id
+}
+
+func (req *CreateApiTokenRequest) GetPermissions() []db.Permission {
+	permissions := make([]db.Permission, len(req.Permissions))
+	for i, p := range req.Permissions {
+		permissions[i], _ = db.ParsePermission(p)
+	}
+	return permissions
+}
+
+type RevokeApiTokenRequest struct {
+	TokenID string `json:"token_id"`
+}
+
+func (req *RevokeApiTokenRequest) IsValid() error {
+	if req.TokenID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing token id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.TokenID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid token id: %v", err)
+	}
+	return nil
+}
+
+func (req *RevokeApiTokenRequest) GetTokenID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.TokenID)
+	return id
+}
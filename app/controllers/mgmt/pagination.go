@@ -0,0 +1,204 @@
+package mgmt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// pageQuery is a keyset paginated query. Documents are sorted by the sort field, then by _id for a stable order,
+// and the cursor points at the last document of the previous page.
+type pageQuery struct {
+	conditions []bson.M
+	sortField  string
+	desc       bool
+	limit      int
+	cursor     *pageCursor
+}
+
+type pageCursor struct {
+	Field string `json:"f"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// parsePageQuery parses the query parameters shared by list endpoints: app_id, version_name_prefix, created_after,
+// created_before (RFC3339), sort (one of sortFields), order (asc or desc, default desc), limit and cursor.
+func parsePageQuery(ctx *gin.Context, sortFields ...string) (pageQuery, error) {
+	q := pageQuery{
+		sortField: sortFields[0],
+		desc:      true,
+		limit:     defaultPageLimit,
+	}
+
+	if s := ctx.Query("app_id"); s != "" {
+		q.conditions = append(q.conditions, bson.M{"app_id": s})
+	}
+	if s := ctx.Query("version_name_prefix"); s != "" {
+		q.conditions = append(q.conditions, bson.M{"version_name": bson.M{"$regex": "^" + regexp.QuoteMeta(s)}})
+	}
+	for param, op := range map[string]string{"created_after": "$gte", "created_before": "$lt"} {
+		if s := ctx.Query(param); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, apperr.Invalid(apperr.CodeInvalidRequest, "invalid %s: %v", param, err)
+			}
+			q.conditions = append(q.conditions, bson.M{"created_at": bson.M{op: t}})
+		}
+	}
+
+	if s := ctx.Query("sort"); s != "" {
+		found := false
+		for _, f := range sortFields {
+			found = found || f == s
+		}
+		if !found {
+			return q, apperr.Invalid(apperr.CodeInvalidRequest, "sort must be one of %v", sortFields)
+		}
+		q.sortField = s
+	}
+	switch ctx.Query("order") {
+	case "", "desc":
+	case "asc":
+		q.desc = false
+	default:
+		return q, apperr.Invalid(apperr.CodeInvalidRequest, "order must be asc or desc")
+	}
+
+	limit, err := parsePageLimit(ctx)
+	if err != nil {
+		return q, err
+	}
+	q.limit = limit
+
+	if s := ctx.Query("cursor"); s != "" {
+		cursor, err := decodePageCursor(s)
+		if err != nil || cursor.Field != q.sortField || cursor.Desc != q.desc {
+			return q, apperr.Invalid(apperr.CodeInvalidRequest, "invalid cursor, or the cursor is of another sort order")
+		}
+		q.cursor = &cursor
+	}
+	return q, nil
+}
+
+// parsePageLimit parses the limit query parameter, defaulting to defaultPageLimit.
+func parsePageLimit(ctx *gin.Context) (int, error) {
+	s := ctx.Query("limit")
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 || limit > maxPageLimit {
+		return 0, apperr.Invalid(apperr.CodeInvalidRequest, "limit must be between 1 and %d", maxPageLimit)
+	}
+	return limit, nil
+}
+
+// findPage returns a page of documents matching the filter, a cursor of the next page (nil on the last page),
+// and the total number of matching documents. sortValue returns the sort field value and the id of a document.
+func findPage[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, q pageQuery, sortValue func(T) (interface{}, primitive.ObjectID)) ([]T, *string, int64, error) {
+	conditions := append([]bson.M{filter}, q.conditions...)
+	total, err := coll.CountDocuments(ctx, bson.M{"$and": conditions})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("count documents: %w", err)
+	}
+
+	if q.cursor != nil {
+		cond, err := q.cursorCondition()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		conditions = append(conditions, cond)
+	}
+
+	order := 1
+	if q.desc {
+		order = -1
+	}
+	cursor, err := coll.Find(ctx, bson.M{"$and": conditions},
+		options.Find().
+			SetSort(bson.D{{Key: q.sortField, Value: order}, {Key: "_id", Value: order}}).
+			SetLimit(int64(q.limit)+1))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("find documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []T
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, nil, 0, fmt.Errorf("decode documents: %w", err)
+	}
+
+	var next *string
+	if len(docs) > q.limit {
+		docs = docs[:q.limit]
+		value, id := sortValue(docs[len(docs)-1])
+		s := encodePageCursor(q.sortField, q.desc, value, id)
+		next = &s
+	}
+	return docs, next, total, nil
+}
+
+// cursorCondition matches documents after the cursor in the sort order.
+func (q pageQuery) cursorCondition() (bson.M, error) {
+	id, err := primitive.ObjectIDFromHex(q.cursor.ID)
+	if err != nil {
+		return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid cursor")
+	}
+	var value interface{} = q.cursor.Value
+	if q.sortField == "created_at" {
+		t, err := time.Parse(time.RFC3339Nano, q.cursor.Value)
+		if err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid cursor")
+		}
+		value = t
+	}
+
+	op := "$gt"
+	if q.desc {
+		op = "$lt"
+	}
+	return bson.M{"$or": []bson.M{
+		{q.sortField: bson.M{op: value}},
+		{q.sortField: value, "_id": bson.M{op: id}},
+	}}, nil
+}
+
+func encodePageCursor(field string, desc bool, value interface{}, id primitive.ObjectID) string {
+	c := pageCursor{Field: field, Desc: desc, ID: id.Hex()}
+	switch v := value.(type) {
+	case time.Time:
+		c.Value = v.UTC().Format(time.RFC3339Nano)
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
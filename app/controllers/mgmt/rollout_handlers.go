@@ -0,0 +1,278 @@
+package mgmt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (ctrl *CapgoManagementController) CreateRollout(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req CreateRolloutRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		if release.Rollout.IsRunning() {
+			return nil, apperr.Conflict("rollout_running", "release already has a running rollout. release id: %v", req.ReleaseID)
+		}
+
+		var bundle db.Bundle
+		err = db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetBundleID(), "deleted_at": nil}).Decode(&bundle)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", req.BundleID)
+		}
+		if bundle.AppID != release.AppID {
+			return nil, apperr.Unprocessable("app_mismatch", "bundle %v does not belong to app %v", req.BundleID, release.AppID)
+		}
+
+		fallbackBundleID := release.BuiltinBundleID
+		if release.ActiveBundleID != nil && !release.ActiveBundleID.IsZero() {
+			fallbackBundleID = *release.ActiveBundleID
+		}
+		if req.FallbackBundleID != "" {
+			var fallback db.Bundle
+			err = db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetFallbackBundleID(), "deleted_at": nil}).Decode(&fallback)
+			if err != nil {
+				return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find fallback bundle id: %v", req.FallbackBundleID)
+			}
+			if fallback.AppID != release.AppID {
+				return nil, apperr.Unprocessable("app_mismatch", "fallback bundle %v does not belong to app %v", req.FallbackBundleID, release.AppID)
+			}
+			fallbackBundleID = fallback.ID
+		}
+		if fallbackBundleID == bundle.ID {
+			return nil, apperr.Unprocessable("invalid_rollout_bundle", "rollout bundle must be different from fallback bundle")
+		}
+
+		before := services.AuditSnapshot(release)
+		now := time.Now()
+		release.Rollout = &db.Rollout{
+			BundleID:         bundle.ID,
+			FallbackBundleID: fallbackBundleID,
+			Percentage:       req.Percentage,
+			Status:           db.RolloutStatusActive,
+			StartedAt:        now,
+			UpdatedAt:        now,
+		}
+		var activeBundleID *primitive.ObjectID
+		if req.Percentage == 100 {
+			release.Rollout.Status = db.RolloutStatusCompleted
+			activeBundleID = &bundle.ID
+		}
+
+		if err := saveRollout(ctx.Request.Context(), &release, activeBundleID); err != nil {
+			return nil, err
+		}
+		ctrl.webhookService.Dispatch(ctx.Request.Context(), release.AppID, db.WebhookEventRolloutAdvanced, services.NewWebhookReleaseData(release))
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "rollouts.create",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release), {Type: db.AuditTargetBundle, ID: release.Rollout.BundleID.Hex()}},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Rollout created successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) AdvanceRollout(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req AdvanceRolloutRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		if !release.Rollout.IsRunning() {
+			return nil, apperr.Conflict("rollout_not_running", "release has no running rollout. release id: %v", req.ReleaseID)
+		}
+		if req.Percentage < release.Rollout.Percentage {
+			return nil, apperr.Unprocessable("rollout_percentage_decreased", "rollout percentage cannot be decreased from %d to %d, abort the rollout instead", release.Rollout.Percentage, req.Percentage)
+		}
+
+		before := services.AuditSnapshot(release)
+		release.Rollout.Percentage = req.Percentage
+		release.Rollout.Status = db.RolloutStatusActive
+		release.Rollout.UpdatedAt = time.Now()
+		var activeBundleID *primitive.ObjectID
+		if req.Percentage == 100 {
+			release.Rollout.Status = db.RolloutStatusCompleted
+			activeBundleID = &release.Rollout.BundleID
+		}
+
+		if err := saveRollout(ctx.Request.Context(), &release, activeBundleID); err != nil {
+			return nil, err
+		}
+		ctrl.webhookService.Dispatch(ctx.Request.Context(), release.AppID, db.WebhookEventRolloutAdvanced, services.NewWebhookReleaseData(release))
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "rollouts.advance",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release), {Type: db.AuditTargetBundle, ID: release.Rollout.BundleID.Hex()}},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Rollout advanced successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) PauseRollout(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req RolloutActionRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		if release.Rollout == nil || release.Rollout.Status != db.RolloutStatusActive {
+			return nil, apperr.Conflict("rollout_not_running", "release has no active rollout. release id: %v", req.ReleaseID)
+		}
+
+		before := services.AuditSnapshot(release)
+		release.Rollout.Status = db.RolloutStatusPaused
+		release.Rollout.UpdatedAt = time.Now()
+
+		if err := saveRollout(ctx.Request.Context(), &release, nil); err != nil {
+			return nil, err
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "rollouts.pause",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release), {Type: db.AuditTargetBundle, ID: release.Rollout.BundleID.Hex()}},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Rollout paused successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) AbortRollout(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req RolloutActionRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var release db.Release
+		err := db.Collections().Releases().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetReleaseID()}).Decode(&release)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "release_not_found", "failed to find release id: %v", req.ReleaseID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRelease, release.AppID); err != nil {
+			return nil, err
+		}
+		if !release.Rollout.IsRunning() {
+			return nil, apperr.Conflict("rollout_not_running", "release has no running rollout. release id: %v", req.ReleaseID)
+		}
+
+		before := services.AuditSnapshot(release)
+		release.Rollout.Status = db.RolloutStatusAborted
+		release.Rollout.UpdatedAt = time.Now()
+
+		if err := saveRollout(ctx.Request.Context(), &release, &release.Rollout.FallbackBundleID); err != nil {
+			return nil, err
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "rollouts.abort",
+			AppID:   release.AppID,
+			Targets: []db.AuditTarget{releaseTarget(release), {Type: db.AuditTargetBundle, ID: release.Rollout.BundleID.Hex()}},
+			Before:  before,
+			After:   services.AuditSnapshot(release),
+		})
+
+		return gin.H{
+			"message": "Rollout aborted successfully",
+			"release": mapReleaseToResponse(release),
+		}, nil
+	})
+}
+
+// saveRollout persists the rollout of the release, then invalidates the GetLatest cache, so devices are moved to
+// the new bucket immediately. If activeBundleID is not nil, it becomes the active bundle of the release.
+func saveRollout(ctx context.Context, release *db.Release, activeBundleID *primitive.ObjectID) error {
+	if activeBundleID != nil && (release.ActiveBundleID == nil || *release.ActiveBundleID != *activeBundleID) {
+		updated, err := (&services.ReleaseService{}).SetActiveBundle(ctx, *release, activeBundleID, bson.M{
+			"rollout": release.Rollout,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update release: %w", err)
+		}
+		*release = updated
+		return nil
+	}
+
+	release.UpdatedAt = time.Now()
+	result, err := db.Collections().Releases().UpdateOne(
+		ctx,
+		bson.M{"_id": release.ID},
+		bson.M{
+			"$set": bson.M{
+				"rollout":    release.Rollout,
+				"updated_at": release.UpdatedAt,
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update release: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperr.NotFound("release_not_found", "failed to update release, no affected. release id: %v", release.ID.Hex())
+	}
+
+	services.InvalidateLatestCache(ctx)
+	return nil
+}
@@ -0,0 +1,109 @@
+package mgmt
+
+import (
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RolloutResponse struct {
+	BundleID         string    `json:"bundle_id"`
+	FallbackBundleID string    `json:"fallback_bundle_id"`
+	Percentage       int       `json:"percentage"`
+	Status           string    `json:"status"`
+	StartedAt        time.Time `json:"started_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type CreateRolloutRequest struct {
+	ReleaseID string `json:"release_id"`
+	BundleID  string `json:"bundle_id"`
+	// FallbackBundleID is served to devices outside the percentage. Default is the current active (or builtin) bundle.
+	FallbackBundleID string `json:"fallback_bundle_id"`
+	Percentage       int    `json:"percentage"`
+}
+
+func (req *CreateRolloutRequest) IsValid() error {
+	if req.ReleaseID == "" || req.BundleID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	_, err = primitive.ObjectIDFromHex(req.BundleID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid bundle id: %v", err)
+	}
+	if req.FallbackBundleID != "" {
+		_, err = primitive.ObjectIDFromHex(req.FallbackBundleID)
+		if err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid fallback bundle id: %v", err)
+		}
+	}
+	if req.Percentage < 0 || req.Percentage > 100 {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+func (req *CreateRolloutRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
+func (req *CreateRolloutRequest) GetBundleID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.BundleID)
+	return id
+}
+
+func (req *CreateRolloutRequest) GetFallbackBundleID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.FallbackBundleID)
+	return id
+}
+
+type AdvanceRolloutRequest struct {
+	ReleaseID  string `json:"release_id"`
+	Percentage int    `json:"percentage"`
+}
+
+func (req *AdvanceRolloutRequest) IsValid() error {
+	if req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	if req.Percentage < 0 || req.Percentage > 100 {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+func (req *AdvanceRolloutRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
+
+// RolloutActionRequest is used by rollout actions that only need a release, e.g. pause and abort.
+type RolloutActionRequest struct {
+	ReleaseID string `json:"release_id"`
+}
+
+func (req *RolloutActionRequest) IsValid() error {
+	if req.ReleaseID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing release id")
+	}
+	_, err := primitive.ObjectIDFromHex(req.ReleaseID)
+	if err != nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "invalid release id: %v", err)
+	}
+	return nil
+}
+
+func (req *RolloutActionRequest) GetReleaseID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.ReleaseID)
+	return id
+}
@@ -0,0 +1,138 @@
+package mgmt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListBundleStats returns counts of downloads, successful sets and failures per bundle version name of an app, sorted by
+// version name. Query parameters: app_id (required), bundle_id (optional), since (optional, RFC3339), limit and cursor.
+func (ctrl *CapgoManagementController) ListBundleStats(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		appID := ctx.Query("app_id")
+		if appID == "" {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "missing app id")
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRead, appID); err != nil {
+			return nil, err
+		}
+
+		var since time.Time
+		if s := ctx.Query("since"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid since: %v", err)
+			}
+			since = t
+		}
+
+		limit, err := parsePageLimit(ctx)
+		if err != nil {
+			return nil, err
+		}
+		filter := services.StatsFilter{
+			AppID: appID,
+			Since: since,
+			Limit: limit + 1,
+		}
+		if s := ctx.Query("cursor"); s != "" {
+			cursor, err := decodePageCursor(s)
+			if err != nil || cursor.Field != "version_name" {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid cursor")
+			}
+			filter.After = cursor.Value
+		}
+
+		if s := ctx.Query("bundle_id"); s != "" {
+			bundleID, err := primitive.ObjectIDFromHex(s)
+			if err != nil {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid bundle id: %v", err)
+			}
+			var bundle db.Bundle
+			err = db.Collections().Bundles().FindOne(ctx.Request.Context(), bson.M{"_id": bundleID, "app_id": appID}).Decode(&bundle)
+			if err != nil {
+				return nil, apperr.NotFoundOr(err, "bundle_not_found", "failed to find bundle id: %v", s)
+			}
+			filter.VersionNames = []string{bundle.VersionName}
+		}
+
+		stats, err := ctrl.statsService.CountByVersionName(ctx.Request.Context(), filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count stats: %w", err)
+		}
+		var next *string
+		if len(stats) > limit {
+			stats = stats[:limit]
+			s := encodePageCursor("version_name", false, stats[len(stats)-1].VersionName, primitive.NilObjectID)
+			next = &s
+		}
+
+		bundleIDs, err := findBundleIDsByVersionName(ctx.Request.Context(), appID, stats)
+		if err != nil {
+			return nil, err
+		}
+
+		response := make([]BundleStatsResponse, len(stats))
+		for i, s := range stats {
+			response[i] = BundleStatsResponse{
+				BundleIDs:   bundleIDs[s.VersionName],
+				VersionName: s.VersionName,
+				Downloads:   s.Downloads,
+				Sets:        s.Sets,
+				Failures:    s.Failures,
+			}
+			if response[i].BundleIDs == nil {
+				response[i].BundleIDs = []string{}
+			}
+		}
+
+		return ListBundleStatsResponse{
+			Data:       response,
+			NextCursor: next,
+		}, nil
+	})
+}
+
+// findBundleIDsByVersionName returns ids of bundles of the app with the version names of the stats, by version name.
+func findBundleIDsByVersionName(ctx context.Context, appID string, stats []services.BundleStats) (map[string][]string, error) {
+	ids := map[string][]string{}
+	if len(stats) == 0 {
+		return ids, nil
+	}
+	versionNames := make([]string, len(stats))
+	for i, s := range stats {
+		versionNames[i] = s.VersionName
+	}
+
+	cursor, err := db.Collections().Bundles().Find(ctx,
+		bson.M{"app_id": appID, "version_name": bson.M{"$in": versionNames}},
+		options.Find().
+			SetProjection(bson.M{"_id": 1, "version_name": 1}).
+			SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bundles: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var bundle db.Bundle
+		if err := cursor.Decode(&bundle); err != nil {
+			return nil, fmt.Errorf("failed to decode bundle: %w", err)
+		}
+		ids[bundle.VersionName] = append(ids[bundle.VersionName], bundle.ID.Hex())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch bundles: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,17 @@
+package mgmt
+
+type BundleStatsResponse struct {
+	// BundleIDs are ids of every bundle with the version name, since stats are reported by version name and several
+	// bundles can share one, e.g. aliases. Empty if no bundle has the version name.
+	BundleIDs   []string `json:"bundle_ids"`
+	VersionName string   `json:"version_name"`
+	Downloads   int64    `json:"downloads"`
+	Sets        int64    `json:"sets"`
+	Failures    int64    `json:"failures"`
+}
+
+type ListBundleStatsResponse struct {
+	Data []BundleStatsResponse `json:"data"`
+	// NextCursor is the cursor of the next page. Nil on the last page.
+	NextCursor *string `json:"next_cursor"`
+}
@@ -0,0 +1,346 @@
+package mgmt
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 500
+)
+
+// ListAllWebhooks returns webhooks of an app. Query parameters: app_id (required).
+func (ctrl *CapgoManagementController) ListAllWebhooks(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		appID := ctx.Query("app_id")
+		if appID == "" {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "missing app id")
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRead, appID); err != nil {
+			return nil, err
+		}
+
+		cursor, err := db.Collections().Webhooks().Find(
+			ctx.Request.Context(), bson.M{"app_id": appID},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var webhooks []db.Webhook
+		if err = cursor.All(ctx.Request.Context(), &webhooks); err != nil {
+			return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+		}
+
+		response := make([]WebhookResponse, len(webhooks))
+		for i, webhook := range webhooks {
+			response[i] = mapWebhookToResponse(webhook)
+		}
+
+		return ListAllWebhooksResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) CreateWebhook(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req CreateWebhookRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "invalid request body: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionAdmin, req.AppID); err != nil {
+			return nil, err
+		}
+
+		secret := req.Secret
+		if secret == "" {
+			var err error
+			secret, err = services.GenerateWebhookSecret()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+			}
+		}
+
+		webhook := db.Webhook{
+			ID:        primitive.NewObjectID(),
+			AppID:     req.AppID,
+			URL:       req.URL,
+			Secret:    secret,
+			Events:    req.GetEvents(),
+			Enabled:   req.Enabled == nil || *req.Enabled,
+			UpdatedAt: time.Now(),
+			CreatedAt: time.Now(),
+		}
+
+		_, err := db.Collections().Webhooks().InsertOne(ctx.Request.Context(), webhook)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook: %w", err)
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "webhooks.create",
+			AppID:   webhook.AppID,
+			Targets: []db.AuditTarget{webhookTarget(webhook)},
+			After:   webhookSnapshot(webhook),
+		})
+
+		return gin.H{
+			"message": "Webhook created successfully",
+			"webhook": mapWebhookToResponse(webhook),
+			"secret":  secret,
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) UpdateWebhook(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req UpdateWebhookRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		webhook, err := ctrl.findWebhook(ctx, req.GetWebhookID())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionAdmin, webhook.AppID); err != nil {
+			return nil, err
+		}
+		before := webhookSnapshot(webhook)
+
+		if req.URL != nil {
+			webhook.URL = *req.URL
+		}
+		if req.Events != nil {
+			webhook.Events = req.GetEvents()
+		}
+		if req.Enabled != nil {
+			webhook.Enabled = *req.Enabled
+		}
+		var secret string
+		if req.RotateSecret {
+			secret, err = services.GenerateWebhookSecret()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+			}
+			webhook.Secret = secret
+		}
+		webhook.UpdatedAt = time.Now()
+
+		_, err = db.Collections().Webhooks().ReplaceOne(ctx.Request.Context(), bson.M{"_id": webhook.ID}, webhook)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update webhook: %w", err)
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "webhooks.update",
+			AppID:   webhook.AppID,
+			Targets: []db.AuditTarget{webhookTarget(webhook)},
+			Before:  before,
+			After:   webhookSnapshot(webhook),
+		})
+
+		resp := gin.H{
+			"message": "Webhook updated successfully",
+			"webhook": mapWebhookToResponse(webhook),
+		}
+		if secret != "" {
+			resp["secret"] = secret
+		}
+		return resp, nil
+	})
+}
+
+// DeleteWebhook deletes a webhook. Its pending deliveries are marked as failed by the worker, and the delivery log is kept.
+func (ctrl *CapgoManagementController) DeleteWebhook(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req DeleteWebhookRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		webhook, err := ctrl.findWebhook(ctx, req.GetWebhookID())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionAdmin, webhook.AppID); err != nil {
+			return nil, err
+		}
+
+		_, err = db.Collections().Webhooks().DeleteOne(ctx.Request.Context(), bson.M{"_id": webhook.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete webhook: %w", err)
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action:  "webhooks.delete",
+			AppID:   webhook.AppID,
+			Targets: []db.AuditTarget{webhookTarget(webhook)},
+			Before:  webhookSnapshot(webhook),
+		})
+
+		return gin.H{
+			"message": "Webhook deleted successfully",
+		}, nil
+	})
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest first.
+// Query parameters: webhook_id (required), status (optional) and limit (optional).
+func (ctrl *CapgoManagementController) ListWebhookDeliveries(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		if err := validateObjectID("webhook id", ctx.Query("webhook_id")); err != nil {
+			return nil, err
+		}
+		webhookID, _ := primitive.ObjectIDFromHex(ctx.Query("webhook_id"))
+
+		webhook, err := ctrl.findWebhook(ctx, webhookID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionRead, webhook.AppID); err != nil {
+			return nil, err
+		}
+
+		filter := bson.M{"webhook_id": webhook.ID}
+		if s := ctx.Query("status"); s != "" {
+			filter["status"] = s
+		}
+
+		limit := defaultWebhookDeliveriesLimit
+		if s := ctx.Query("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit <= 0 || limit > maxWebhookDeliveriesLimit {
+				return nil, apperr.Invalid(apperr.CodeInvalidRequest, "limit must be between 1 and %d", maxWebhookDeliveriesLimit)
+			}
+		}
+
+		cursor, err := db.Collections().WebhookDeliveries().Find(
+			ctx.Request.Context(), filter,
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+		}
+		defer cursor.Close(ctx.Request.Context())
+
+		var deliveries []db.WebhookDelivery
+		if err = cursor.All(ctx.Request.Context(), &deliveries); err != nil {
+			return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+		}
+
+		response := make([]WebhookDeliveryResponse, len(deliveries))
+		for i, delivery := range deliveries {
+			response[i] = mapWebhookDeliveryToResponse(delivery)
+		}
+
+		return ListWebhookDeliveriesResponse{
+			Data: response,
+		}, nil
+	})
+}
+
+// RedeliverWebhook queues a delivery again, e.g. after the receiver was fixed.
+func (ctrl *CapgoManagementController) RedeliverWebhook(ctx *gin.Context) {
+	utils.Handle(ctx, func() (interface{}, error) {
+		var req RedeliverWebhookRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "failed to bind request: %v", err)
+		}
+		if err := req.IsValid(); err != nil {
+			return nil, err
+		}
+
+		var delivery db.WebhookDelivery
+		err := db.Collections().WebhookDeliveries().FindOne(ctx.Request.Context(), bson.M{"_id": req.GetDeliveryID()}).Decode(&delivery)
+		if err != nil {
+			return nil, apperr.NotFoundOr(err, "webhook_delivery_not_found", "failed to find delivery id: %v", req.DeliveryID)
+		}
+		if _, err := ctrl.authorizeApp(ctx, db.PermissionAdmin, delivery.AppID); err != nil {
+			return nil, err
+		}
+		if delivery.Status == db.WebhookDeliveryStatusPending {
+			return nil, apperr.Conflict("webhook_delivery_pending", "delivery is still pending. delivery id: %v", req.DeliveryID)
+		}
+
+		if err := ctrl.webhookService.Redeliver(ctx.Request.Context(), delivery.ID); err != nil {
+			return nil, fmt.Errorf("failed to redeliver webhook: %w", err)
+		}
+		ctrl.audit(ctx, db.AuditEvent{
+			Action: "webhooks.redeliver",
+			AppID:  delivery.AppID,
+			Targets: []db.AuditTarget{
+				{Type: db.AuditTargetWebhook, ID: delivery.WebhookID.Hex()},
+				webhookDeliveryTarget(delivery),
+			},
+		})
+
+		return gin.H{
+			"message": "Webhook delivery queued successfully",
+		}, nil
+	})
+}
+
+func (ctrl *CapgoManagementController) findWebhook(ctx *gin.Context, webhookID primitive.ObjectID) (db.Webhook, error) {
+	var webhook db.Webhook
+	err := db.Collections().Webhooks().FindOne(ctx.Request.Context(), bson.M{"_id": webhookID}).Decode(&webhook)
+	if err != nil {
+		return db.Webhook{}, apperr.NotFoundOr(err, "webhook_not_found", "failed to find webhook id: %v", webhookID.Hex())
+	}
+	return webhook, nil
+}
+
+func mapWebhookToResponse(webhook db.Webhook) WebhookResponse {
+	events := make([]string, len(webhook.Events))
+	for i, e := range webhook.Events {
+		events[i] = string(e)
+	}
+	return WebhookResponse{
+		ID:        webhook.ID.Hex(),
+		AppID:     webhook.AppID,
+		URL:       webhook.URL,
+		Events:    events,
+		Enabled:   webhook.Enabled,
+		UpdatedAt: webhook.UpdatedAt,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func mapWebhookDeliveryToResponse(delivery db.WebhookDelivery) WebhookDeliveryResponse {
+	r := WebhookDeliveryResponse{
+		ID:             delivery.ID.Hex(),
+		WebhookID:      delivery.WebhookID.Hex(),
+		AppID:          delivery.AppID,
+		Event:          string(delivery.Event),
+		Payload:        delivery.Payload,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+	}
+	if delivery.Status == db.WebhookDeliveryStatusPending {
+		r.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return r
+}
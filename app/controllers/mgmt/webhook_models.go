@@ -0,0 +1,154 @@
+package mgmt
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookResponse struct {
+	ID        string    `json:"id"`
+	AppID     string    `json:"app_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListAllWebhooksResponse struct {
+	Data []WebhookResponse `json:"data"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhook_id"`
+	AppID          string     `json:"app_id"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Data []WebhookDeliveryResponse `json:"data"`
+}
+
+// CreateWebhookRequest registers a webhook of an app. Empty events subscribe to every event. A secret is generated
+// if not provided, and it's only returned in the response of this request.
+type CreateWebhookRequest struct {
+	AppID   string   `json:"app_id"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret"`
+	Enabled *bool    `json:"enabled"`
+}
+
+func (req *CreateWebhookRequest) IsValid() error {
+	if req.AppID == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "missing app id")
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		return err
+	}
+	if _, err := parseWebhookEvents(req.Events); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (req *CreateWebhookRequest) GetEvents() []db.WebhookEvent {
+	events, _ := parseWebhookEvents(req.Events)
+	return events
+}
+
+// UpdateWebhookRequest changes a webhook. Nil fields are left unchanged. RotateSecret generates a new secret,
+// which is only returned in the response of this request.
+type UpdateWebhookRequest struct {
+	WebhookID    string    `json:"webhook_id"`
+	URL          *string   `json:"url"`
+	Events       *[]string `json:"events"`
+	Enabled      *bool     `json:"enabled"`
+	RotateSecret bool      `json:"rotate_secret"`
+}
+
+func (req *UpdateWebhookRequest) IsValid() error {
+	if err := validateObjectID("webhook id", req.WebhookID); err != nil {
+		return err
+	}
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return err
+		}
+	}
+	if req.Events != nil {
+		if _, err := parseWebhookEvents(*req.Events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (req *UpdateWebhookRequest) GetWebhookID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.WebhookID)
+	return id
+}
+
+func (req *UpdateWebhookRequest) GetEvents() []db.WebhookEvent {
+	events, _ := parseWebhookEvents(*req.Events)
+	return events
+}
+
+type DeleteWebhookRequest struct {
+	WebhookID string `json:"webhook_id"`
+}
+
+func (req *DeleteWebhookRequest) IsValid() error {
+	return validateObjectID("webhook id", req.WebhookID)
+}
+
+func (req *DeleteWebhookRequest) GetWebhookID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.WebhookID)
+	return id
+}
+
+type RedeliverWebhookRequest struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+func (req *RedeliverWebhookRequest) IsValid() error {
+	return validateObjectID("delivery id", req.DeliveryID)
+}
+
+func (req *RedeliverWebhookRequest) GetDeliveryID() primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(req.DeliveryID)
+	return id
+}
+
+func validateWebhookURL(val string) error {
+	u, err := url.Parse(val)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "webhook url must be an absolute http or https url")
+	}
+	return nil
+}
+
+func parseWebhookEvents(values []string) ([]db.WebhookEvent, error) {
+	events := make([]db.WebhookEvent, 0, len(values))
+	for _, v := range values {
+		e, err := db.ParseWebhookEvent(v)
+		if err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidRequest, "%v", err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -1,18 +1,24 @@
 package authn
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
 
-	"github.com/coreos/go-oidc"
 	"github.com/gin-gonic/gin"
-	"github.com/tanapoln/capgo-server/config"
-	"golang.org/x/oauth2"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/services"
 )
 
+// NewApiKeyMiddleware authenticates a static key of the config as a superadmin, or an organization API token.
+// The resolved principal is put on the gin context.
 func NewApiKeyMiddleware(headerKey string, keys []string) gin.HandlerFunc {
+	tokenService := &services.ApiTokenService{}
+
 	return func(c *gin.Context) {
 		apiKey := strings.TrimSpace(c.GetHeader(headerKey))
 		if apiKey == "" {
@@ -20,16 +26,34 @@ func NewApiKeyMiddleware(headerKey string, keys []string) gin.HandlerFunc {
 			return
 		}
 
-		if !slices.Contains(keys, apiKey) {
+		if slices.Contains(keys, apiKey) {
+			// Static keys are identified by a fingerprint, so audit events never contain the key itself.
+			SetPrincipal(c, SuperadminPrincipal(PrincipalKindStaticKey, services.HashApiToken(apiKey)[:12]))
+			c.Next()
+			return
+		}
+
+		token, err := tokenService.Authenticate(c.Request.Context(), apiKey)
+		if err != nil {
+			if !errors.Is(err, services.ErrApiTokenInvalid) {
+				slog.Error("Error authenticating api token", "error", err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
+		SetPrincipal(c, PrincipalFromApiToken(token))
 		c.Next()
 	}
 }
 
+// NewOAuthMiddleware authenticates an OIDC access token with the cached provider of StartOIDCProvider, and maps claims of the user to roles.
+// A user without any role is rejected.
 func NewOAuthMiddleware(headerKey string) gin.HandlerFunc {
+	roleMapper := NewRoleMapperFromConfig()
+
 	return func(c *gin.Context) {
 		oauthToken := strings.TrimSpace(c.GetHeader(headerKey))
 		if oauthToken == "" {
@@ -49,20 +73,52 @@ func NewOAuthMiddleware(headerKey string) gin.HandlerFunc {
 			return
 		}
 
-		provider, err := oidc.NewProvider(c.Request.Context(), config.Get().OAuthIssuer)
+		identity, err := VerifyOIDCToken(c.Request.Context(), authToken)
 		if err != nil {
-			slog.Error("Error creating OAuth provider", "error", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			if errors.Is(err, ErrOIDCUnavailable) {
+				slog.Error("Error verifying OAuth token", "error", err)
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+				return
+			}
+			slog.Info("Error verifying OAuth token", "error", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		_, err = provider.UserInfo(c.Request.Context(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: authToken}))
-		if err != nil {
-			slog.Info("Error getting user info", "error", err)
-			c.AbortWithStatus(http.StatusUnauthorized)
+		roles := roleMapper.Roles(identity.Claims, identity.Email, identity.EmailVerified)
+		if len(roles) == 0 {
+			slog.Info("OAuth user has no role", "subject", identity.Subject)
+			utils.RespondError(c, apperr.Forbidden("no_role", "user has no role"))
+			c.Abort()
+			return
+		}
+
+		SetPrincipal(c, PrincipalFromRoles(identity.Subject, roles))
+
+		c.Next()
+	}
+}
+
+// Require rejects a request of a principal without the permission. Every management route declares its permission.
+func Require(perm db.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetPrincipal(c).Has(perm) {
+			utils.RespondError(c, apperr.Forbidden("permission_denied", "%v permission is required", perm))
+			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
+// RequireSuperadmin rejects a request of a principal that isn't a superadmin.
+func RequireSuperadmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetPrincipal(c).Superadmin {
+			utils.RespondError(c, apperr.Forbidden("permission_denied", "superadmin is required"))
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,152 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/patrickmn/go-cache"
+	"github.com/tanapoln/capgo-server/config"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcRetryInterval = 30 * time.Second
+	userInfoCacheTTL  = time.Minute
+)
+
+var (
+	ErrOIDCUnavailable  = errors.New("oidc provider is not available")
+	ErrOIDCTokenInvalid = errors.New("oidc token is invalid")
+
+	oidcState = struct {
+		sync.RWMutex
+		provider *oidc.Provider
+		verifier *oidc.IDTokenVerifier
+	}{}
+
+	userInfoCache = cache.New(userInfoCacheTTL, userInfoCacheTTL*5)
+)
+
+// OIDCIdentity is a user authenticated by an access token.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Claims        map[string]interface{}
+}
+
+// StartOIDCProvider discovers the OAUTH_ISSUER provider and refreshes it periodically, so JWKS and endpoints are
+// cached instead of fetched on every request. A failed discovery is retried sooner. Calling the returned stop
+// function waits for the refresher to exit.
+func StartOIDCProvider() (stop func()) {
+	issuer := config.Get().OAuthIssuer
+	if issuer == "" {
+		slog.Info("OIDC provider is disabled")
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			interval := config.Get().OAuthRefreshInterval
+			if err := refreshOIDCProvider(ctx, issuer); err != nil {
+				slog.Error("Failed to discover OIDC provider", "error", err, "issuer", issuer)
+				interval = oidcRetryInterval
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// refreshOIDCProvider replaces the cached provider. ctx must live as long as the provider, because the remote key set
+// of the provider uses it for fetching keys.
+func refreshOIDCProvider(ctx context.Context, issuer string) error {
+	ctx = oidc.ClientContext(ctx, &http.Client{Timeout: 10 * time.Second})
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return err
+	}
+	verifier := provider.Verifier(&oidc.Config{
+		ClientID: config.Get().OAuthClientID,
+	})
+
+	oidcState.Lock()
+	defer oidcState.Unlock()
+	oidcState.provider = provider
+	oidcState.verifier = verifier
+	return nil
+}
+
+// VerifyOIDCToken verifies a JWT access token locally against the cached JWKS, issuer, audience (OAUTH_CLIENT_ID) and expiry.
+// Opaque tokens are checked at the userinfo endpoint if OAUTH_USERINFO_FALLBACK is enabled, and the result is cached briefly.
+func VerifyOIDCToken(ctx context.Context, token string) (OIDCIdentity, error) {
+	oidcState.RLock()
+	provider, verifier := oidcState.provider, oidcState.verifier
+	oidcState.RUnlock()
+	if provider == nil {
+		return OIDCIdentity{}, ErrOIDCUnavailable
+	}
+
+	if strings.Count(token, ".") == 2 {
+		idToken, err := verifier.Verify(ctx, token)
+		if err != nil {
+			return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+		}
+
+		identity := OIDCIdentity{Subject: idToken.Subject}
+		if err := idToken.Claims(&identity.Claims); err != nil {
+			return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+		}
+		identity.Email, _ = identity.Claims["email"].(string)
+		identity.EmailVerified, _ = identity.Claims["email_verified"].(bool)
+		return identity, nil
+	}
+
+	if !config.Get().OAuthUserInfoFallback {
+		return OIDCIdentity{}, fmt.Errorf("%w: opaque token is not allowed", ErrOIDCTokenInvalid)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if v, ok := userInfoCache.Get(key); ok {
+		return v.(OIDCIdentity), nil
+	}
+
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+	identity := OIDCIdentity{
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+	}
+	if err := userInfo.Claims(&identity.Claims); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+	userInfoCache.Set(key, identity, cache.DefaultExpiration)
+	return identity, nil
+}
@@ -0,0 +1,373 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+)
+
+const testClientID = "capgo-server"
+
+// testIssuer is an OIDC provider serving discovery, JWKS and userinfo endpoints.
+type testIssuer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	keys         map[string]*rsa.PrivateKey
+	jwksRequests int
+	// userInfo maps opaque access tokens to their userinfo claims.
+	userInfo         map[string]map[string]interface{}
+	userInfoRequests int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{
+		keys:     map[string]*rsa.PrivateKey{},
+		userInfo: map[string]map[string]interface{}{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                iss.URL,
+			"authorization_endpoint":                iss.URL + "/authorize",
+			"token_endpoint":                        iss.URL + "/token",
+			"jwks_uri":                              iss.URL + "/jwks",
+			"userinfo_endpoint":                     iss.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.jwksRequests++
+
+		keys := []map[string]string{}
+		for kid, key := range iss.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		writeJSON(w, map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.userInfoRequests++
+
+		claims, ok := iss.userInfo[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, claims)
+	})
+
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// addKey generates a signing key and publishes it in the JWKS.
+func (iss *testIssuer) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys[kid] = key
+}
+
+func (iss *testIssuer) jwksRequestCount() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.jwksRequests
+}
+
+func (iss *testIssuer) userInfoRequestCount() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.userInfoRequests
+}
+
+// claims are valid claims of a token issued to the test client, overridden by the given claims.
+func (iss *testIssuer) claims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": iss.URL,
+		"aud": testClientID,
+		"sub": "user-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		claims[k] = v
+	}
+	return claims
+}
+
+// sign signs claims as an RS256 JWT with the key of kid.
+func (iss *testIssuer) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	iss.mu.Lock()
+	key := iss.keys[kid]
+	iss.mu.Unlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// setupOIDC configures the OAUTH_* settings for the issuer and discovers it.
+func setupOIDC(t *testing.T, iss *testIssuer, userInfoFallback bool) {
+	t.Helper()
+	t.Setenv("MANAGEMENT_API_TOKENS", "test")
+	t.Setenv("OAUTH_ISSUER", iss.URL)
+	t.Setenv("OAUTH_CLIENT_ID", testClientID)
+	t.Setenv("OAUTH_ROLE_CLAIM", "realm_access.roles")
+	t.Setenv("OAUTH_CLAIM_ROLES", "capgo-devs:developer,capgo-admins:admin")
+	t.Setenv("OAUTH_DOMAIN_ROLES", "example.com:viewer")
+	t.Setenv("OAUTH_DEFAULT_ROLE", "")
+	if userInfoFallback {
+		t.Setenv("OAUTH_USERINFO_FALLBACK", "true")
+	} else {
+		t.Setenv("OAUTH_USERINFO_FALLBACK", "false")
+	}
+	if err := config.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := refreshOIDCProvider(ctx, iss.URL); err != nil {
+		t.Fatal(err)
+	}
+	userInfoCache.Flush()
+	t.Cleanup(func() {
+		oidcState.Lock()
+		defer oidcState.Unlock()
+		oidcState.provider = nil
+		oidcState.verifier = nil
+	})
+}
+
+// authenticate runs the OAuth middleware with the token and returns the response status and the principal.
+func authenticate(token string) (int, *Principal) {
+	gin.SetMode(gin.TestMode)
+	var principal *Principal
+	r := gin.New()
+	r.GET("/", NewOAuthMiddleware("Authorization"), func(c *gin.Context) {
+		principal = GetPrincipal(c)
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w.Code, principal
+}
+
+func TestVerifyOIDCTokenWithRoleMapping(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "key-1")
+	setupOIDC(t, iss, false)
+
+	token := iss.sign(t, "key-1", iss.claims(map[string]interface{}{
+		"email":          "dev@example.com",
+		"email_verified": true,
+		"realm_access":   map[string]interface{}{"roles": []string{"capgo-devs", "unrelated"}},
+	}))
+
+	identity, err := VerifyOIDCToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyOIDCToken() error = %v", err)
+	}
+	if identity.Subject != "user-1" || identity.Email != "dev@example.com" || !identity.EmailVerified {
+		t.Errorf("VerifyOIDCToken() = %+v", identity)
+	}
+
+	status, principal := authenticate(token)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if principal == nil || principal.Kind != PrincipalKindOAuth || principal.Subject != "user-1" {
+		t.Fatalf("principal = %+v", principal)
+	}
+	for _, perm := range []db.Permission{db.PermissionRead, db.PermissionUpload} {
+		if !principal.Has(perm) {
+			t.Errorf("principal doesn't have permission %s", perm)
+		}
+	}
+	if principal.Has(db.PermissionRelease) || principal.Superadmin {
+		t.Errorf("principal has more than developer permissions: %+v", principal)
+	}
+}
+
+func TestVerifyOIDCTokenWithoutRole(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "key-1")
+	setupOIDC(t, iss, false)
+
+	// The email domain maps to a role only if the email is verified.
+	token := iss.sign(t, "key-1", iss.claims(map[string]interface{}{
+		"email":          "someone@example.com",
+		"email_verified": false,
+	}))
+	if status, _ := authenticate(token); status != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestVerifyOIDCTokenRejectsInvalidTokens(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "key-1")
+	setupOIDC(t, iss, false)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{name: "wrong audience", claims: map[string]interface{}{"aud": "another-client"}},
+		{name: "wrong issuer", claims: map[string]interface{}{"iss": "https://issuer.example.com"}},
+		{name: "expired", claims: map[string]interface{}{
+			"iat": time.Now().Add(-2 * time.Hour).Unix(),
+			"exp": time.Now().Add(-time.Hour).Unix(),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := iss.sign(t, "key-1", iss.claims(tt.claims))
+			_, err := VerifyOIDCToken(context.Background(), token)
+			if !errors.Is(err, ErrOIDCTokenInvalid) {
+				t.Errorf("VerifyOIDCToken() error = %v, want %v", err, ErrOIDCTokenInvalid)
+			}
+			if status, _ := authenticate(token); status != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestVerifyOIDCTokenRefreshesJWKSOnUnknownKey(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "key-1")
+	setupOIDC(t, iss, false)
+
+	if _, err := VerifyOIDCToken(context.Background(), iss.sign(t, "key-1", iss.claims(nil))); err != nil {
+		t.Fatalf("VerifyOIDCToken() error = %v", err)
+	}
+	before := iss.jwksRequestCount()
+
+	// The provider rotates its keys after the JWKS is cached.
+	iss.addKey(t, "key-2")
+	identity, err := VerifyOIDCToken(context.Background(), iss.sign(t, "key-2", iss.claims(map[string]interface{}{"sub": "user-2"})))
+	if err != nil {
+		t.Fatalf("VerifyOIDCToken() with a rotated key error = %v", err)
+	}
+	if identity.Subject != "user-2" {
+		t.Errorf("Subject = %q, want %q", identity.Subject, "user-2")
+	}
+	if after := iss.jwksRequestCount(); after <= before {
+		t.Errorf("JWKS requests = %d, want more than %d", after, before)
+	}
+
+	// A key that the provider doesn't publish is still rejected after the refresh.
+	unknown := newTestIssuer(t)
+	unknown.addKey(t, "key-3")
+	token := unknown.sign(t, "key-3", iss.claims(nil))
+	if _, err := VerifyOIDCToken(context.Background(), token); !errors.Is(err, ErrOIDCTokenInvalid) {
+		t.Errorf("VerifyOIDCToken() with an unpublished key error = %v, want %v", err, ErrOIDCTokenInvalid)
+	}
+}
+
+func TestVerifyOIDCTokenUserInfoFallback(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "key-1")
+	iss.userInfo["opaque-admin-token"] = map[string]interface{}{
+		"sub":            "admin-1",
+		"email":          "admin@corp.example",
+		"email_verified": true,
+		"realm_access":   map[string]interface{}{"roles": []string{"capgo-admins"}},
+	}
+	setupOIDC(t, iss, true)
+
+	identity, err := VerifyOIDCToken(context.Background(), "opaque-admin-token")
+	if err != nil {
+		t.Fatalf("VerifyOIDCToken() error = %v", err)
+	}
+	if identity.Subject != "admin-1" || identity.Email != "admin@corp.example" || !identity.EmailVerified {
+		t.Errorf("VerifyOIDCToken() = %+v", identity)
+	}
+
+	// The userinfo result is cached.
+	status, principal := authenticate("opaque-admin-token")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if principal == nil || principal.Subject != "admin-1" || !slices.Contains(principal.Permissions, db.PermissionAdmin) {
+		t.Errorf("principal = %+v", principal)
+	}
+	if n := iss.userInfoRequestCount(); n != 1 {
+		t.Errorf("userinfo requests = %d, want 1", n)
+	}
+
+	if _, err := VerifyOIDCToken(context.Background(), "opaque-unknown-token"); !errors.Is(err, ErrOIDCTokenInvalid) {
+		t.Errorf("VerifyOIDCToken() with an unknown opaque token error = %v, want %v", err, ErrOIDCTokenInvalid)
+	}
+}
+
+func TestVerifyOIDCTokenRejectsOpaqueTokenWithoutFallback(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "key-1")
+	iss.userInfo["opaque-token"] = map[string]interface{}{"sub": "user-1"}
+	setupOIDC(t, iss, false)
+
+	if _, err := VerifyOIDCToken(context.Background(), "opaque-token"); !errors.Is(err, ErrOIDCTokenInvalid) {
+		t.Errorf("VerifyOIDCToken() error = %v, want %v", err, ErrOIDCTokenInvalid)
+	}
+	if n := iss.userInfoRequestCount(); n != 0 {
+		t.Errorf("userinfo requests = %d, want 0", n)
+	}
+}
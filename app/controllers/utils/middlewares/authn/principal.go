@@ -0,0 +1,107 @@
+package authn
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const principalContextKey = "authn.principal"
+
+const (
+	PrincipalKindStaticKey = "static_key"
+	PrincipalKindApiToken  = "api_token"
+	PrincipalKindOAuth     = "oauth"
+)
+
+// Principal is the authenticated caller of a management API.
+type Principal struct {
+	Kind string
+	// Subject identifies the caller, e.g. an API token id or an OIDC subject.
+	Subject string
+
+	// Superadmin can do everything to every app and organization, e.g. static keys of MANAGEMENT_API_TOKENS.
+	Superadmin bool
+	// Global principals can access every app with their permissions, e.g. OIDC users with a non-admin role.
+	Global bool
+
+	// OrgID is the organization of the caller. Nil for superadmins.
+	OrgID *primitive.ObjectID
+	// AppIDs limits the caller to some apps of the organization. Empty allows every app of the organization.
+	AppIDs      []string
+	Permissions []db.Permission
+}
+
+// SuperadminPrincipal is a principal that's allowed to do everything.
+func SuperadminPrincipal(kind string, subject string) *Principal {
+	return &Principal{
+		Kind:        kind,
+		Subject:     subject,
+		Superadmin:  true,
+		Permissions: []db.Permission{db.PermissionAdmin},
+	}
+}
+
+// PrincipalFromApiToken is a principal of an organization API token.
+func PrincipalFromApiToken(token db.ApiToken) *Principal {
+	orgID := token.OrgID
+	return &Principal{
+		Kind:        PrincipalKindApiToken,
+		Subject:     token.ID.Hex(),
+		OrgID:       &orgID,
+		AppIDs:      token.AppIDs,
+		Permissions: token.Permissions,
+	}
+}
+
+// Has reports whether the principal has the permission. Admin implies every permission.
+func (p *Principal) Has(perm db.Permission) bool {
+	if p.Superadmin || slices.Contains(p.Permissions, db.PermissionAdmin) {
+		return true
+	}
+	return slices.Contains(p.Permissions, perm)
+}
+
+// CanAccessApp reports whether the app is in the scope of the principal.
+func (p *Principal) CanAccessApp(app db.App) bool {
+	if p.Superadmin || p.Global {
+		return true
+	}
+	if p.OrgID == nil || app.OrgID == nil || *p.OrgID != *app.OrgID {
+		return false
+	}
+	return len(p.AppIDs) == 0 || slices.Contains(p.AppIDs, app.AppID)
+}
+
+// CanAccessOrg reports whether the principal belongs to the organization.
+func (p *Principal) CanAccessOrg(orgID primitive.ObjectID) bool {
+	return p.Superadmin || (p.OrgID != nil && *p.OrgID == orgID)
+}
+
+// Authorize checks that the principal has the permission on the app.
+func (p *Principal) Authorize(perm db.Permission, app db.App) error {
+	if !p.CanAccessApp(app) {
+		return apperr.Forbidden("app_access_denied", "access to app %v is denied", app.AppID)
+	}
+	if !p.Has(perm) {
+		return apperr.Forbidden("permission_denied", "%v permission is required for app %v", perm, app.AppID)
+	}
+	return nil
+}
+
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalContextKey, p)
+}
+
+// GetPrincipal returns the authenticated caller. A request without a principal has no permission at all.
+func GetPrincipal(c *gin.Context) *Principal {
+	if v, ok := c.Get(principalContextKey); ok {
+		if p, ok := v.(*Principal); ok {
+			return p
+		}
+	}
+	return &Principal{}
+}
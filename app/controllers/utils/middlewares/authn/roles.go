@@ -0,0 +1,158 @@
+package authn
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+)
+
+type Role string
+
+const (
+	RoleViewer         Role = "viewer"
+	RoleDeveloper      Role = "developer"
+	RoleReleaseManager Role = "release-manager"
+	// RoleAdmin is a superadmin, e.g. it can manage organizations.
+	RoleAdmin Role = "admin"
+)
+
+var rolePermissions = map[Role][]db.Permission{
+	RoleViewer:         {db.PermissionRead},
+	RoleDeveloper:      {db.PermissionRead, db.PermissionUpload},
+	RoleReleaseManager: {db.PermissionRead, db.PermissionUpload, db.PermissionRelease},
+	RoleAdmin:          {db.PermissionAdmin},
+}
+
+func ParseRole(val string) (Role, error) {
+	r := Role(strings.TrimSpace(strings.ToLower(val)))
+	if _, ok := rolePermissions[r]; !ok {
+		return "", fmt.Errorf("invalid role: %s", val)
+	}
+	return r, nil
+}
+
+// RoleMapper maps OIDC claims of a user to roles.
+type RoleMapper struct {
+	// claim is a dot separated path of a claim, e.g. groups or realm_access.roles.
+	claim        string
+	claimRoles   map[string]Role
+	domainRoles  map[string]Role
+	defaultRoles []Role
+}
+
+// NewRoleMapperFromConfig creates a RoleMapper from the OAUTH_ROLE_* configs. Invalid roles are logged and ignored.
+func NewRoleMapperFromConfig() *RoleMapper {
+	cfg := config.Get()
+	m := &RoleMapper{
+		claim:       cfg.OAuthRoleClaim,
+		claimRoles:  map[string]Role{},
+		domainRoles: map[string]Role{},
+	}
+	for val, role := range cfg.OAuthClaimRoles {
+		if r, err := ParseRole(role); err != nil {
+			slog.Error("Invalid OAuth claim role mapping", "value", val, "error", err)
+		} else {
+			m.claimRoles[val] = r
+		}
+	}
+	for domain, role := range cfg.OAuthDomainRoles {
+		if r, err := ParseRole(role); err != nil {
+			slog.Error("Invalid OAuth email domain role mapping", "domain", domain, "error", err)
+		} else {
+			m.domainRoles[strings.ToLower(domain)] = r
+		}
+	}
+	if cfg.OAuthDefaultRole != "" {
+		if r, err := ParseRole(cfg.OAuthDefaultRole); err != nil {
+			slog.Error("Invalid OAuth default role", "error", err)
+		} else {
+			m.defaultRoles = []Role{r}
+		}
+	}
+	return m
+}
+
+// Roles returns the roles of a user. Roles come from values of the role claim, then the domain of a verified email.
+// The default role is used when nothing matches.
+func (m *RoleMapper) Roles(claims map[string]interface{}, email string, emailVerified bool) []Role {
+	var roles []Role
+	add := func(r Role) {
+		if !slices.Contains(roles, r) {
+			roles = append(roles, r)
+		}
+	}
+
+	if m.claim != "" {
+		for _, val := range claimValues(claims, m.claim) {
+			if r, ok := m.claimRoles[val]; ok {
+				add(r)
+			}
+		}
+	}
+
+	if emailVerified {
+		if _, domain, ok := strings.Cut(email, "@"); ok {
+			if r, ok := m.domainRoles[strings.ToLower(domain)]; ok {
+				add(r)
+			}
+		}
+	}
+
+	if len(roles) == 0 {
+		return m.defaultRoles
+	}
+	return roles
+}
+
+// claimValues returns string values of a claim at a dot separated path. The claim can be a string or a list of strings.
+func claimValues(claims map[string]interface{}, path string) []string {
+	var cur interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[key]
+	}
+
+	switch v := cur.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// PrincipalFromRoles is a principal of an OIDC user. Admin makes the user a superadmin, other roles grant their permissions
+// on every app.
+func PrincipalFromRoles(subject string, roles []Role) *Principal {
+	if slices.Contains(roles, RoleAdmin) {
+		return SuperadminPrincipal(PrincipalKindOAuth, subject)
+	}
+
+	p := &Principal{
+		Kind:    PrincipalKindOAuth,
+		Subject: subject,
+		Global:  len(roles) > 0,
+	}
+	for _, r := range roles {
+		for _, perm := range rolePermissions[r] {
+			if !slices.Contains(p.Permissions, perm) {
+				p.Permissions = append(p.Permissions, perm)
+			}
+		}
+	}
+	return p
+}
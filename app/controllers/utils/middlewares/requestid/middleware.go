@@ -0,0 +1,33 @@
+package requestid
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+)
+
+const (
+	HeaderKey  = "X-Request-Id"
+	contextKey = "requestid.id"
+
+	maxLength = 128
+)
+
+// NewMiddleware assigns an id to every request. An id sent by the client (or a proxy) is kept, so requests can be
+// traced across services. The id is returned in the response header.
+func NewMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderKey)
+		if id == "" || len(id) > maxLength {
+			id = xid.New().String()
+		}
+
+		c.Set(contextKey, id)
+		c.Header(HeaderKey, id)
+		c.Next()
+	}
+}
+
+// Get returns the id of the request, or an empty string if the middleware is not used.
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
@@ -1,25 +1,64 @@
 package utils
 
 import (
-	"fmt"
 	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/xid"
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/requestid"
 )
 
+// ErrorResponse is the error body of every management API. Kind and code are stable and meant for API clients,
+// while error is a human readable message.
+type ErrorResponse struct {
+	Error   string         `json:"error"`
+	Kind    apperr.Kind    `json:"kind"`
+	Code    string         `json:"code"`
+	Details map[string]any `json:"details,omitempty"`
+	Trace   string         `json:"trace"`
+}
+
 func Handle(ctx *gin.Context, fn func() (interface{}, error)) {
 	resp, err := fn()
 
 	if err != nil {
-		traceId := xid.New().String()
-		slog.Error("handler return error. response with HTTP 500", "trace", traceId, "error", err, "path", ctx.Request.RequestURI)
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Internal Server Error. trace=%s", traceId),
-		})
+		RespondError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, resp)
 }
+
+// RespondError responds the error according to its application error kind. Details of internal errors are only logged.
+func RespondError(ctx *gin.Context, err error) {
+	// The request id is used as the trace, so the error can be found in audit events and logs of the request.
+	traceId := requestid.Get(ctx)
+	if traceId == "" {
+		traceId = xid.New().String()
+	}
+	appErr := apperr.From(err)
+	status := appErr.Kind.HTTPStatus()
+
+	resp := ErrorResponse{
+		Error:   err.Error(),
+		Kind:    appErr.Kind,
+		Code:    appErr.Code,
+		Details: appErr.Details,
+		Trace:   traceId,
+	}
+
+	switch appErr.Kind {
+	case apperr.KindInternal:
+		slog.Error("handler return error. response with HTTP 500", "trace", traceId, "error", err, "path", ctx.Request.RequestURI)
+		resp.Error = "Internal Server Error. trace=" + traceId
+	case apperr.KindUnavailable:
+		slog.Error("handler return error. response with HTTP 503", "trace", traceId, "error", err, "path", ctx.Request.RequestURI)
+		resp.Error = "Service Unavailable. trace=" + traceId
+	default:
+		slog.Info("handler return error", "trace", traceId, "status", status, "code", appErr.Code, "error", err, "path", ctx.Request.RequestURI)
+	}
+
+	ctx.AbortWithStatusJSON(status, resp)
+}
@@ -5,6 +5,18 @@ import "go.mongodb.org/mongo-driver/mongo"
 type collections struct {
 }
 
+func (c collections) Organizations() *mongo.Collection {
+	return Database().Collection("organizations")
+}
+
+func (c collections) ApiTokens() *mongo.Collection {
+	return Database().Collection("api_tokens")
+}
+
+func (c collections) Apps() *mongo.Collection {
+	return Database().Collection("apps")
+}
+
 func (c collections) Bundles() *mongo.Collection {
 	return Database().Collection("bundles")
 }
@@ -13,6 +25,34 @@ func (c collections) Releases() *mongo.Collection {
 	return Database().Collection("releases")
 }
 
+func (c collections) Channels() *mongo.Collection {
+	return Database().Collection("channels")
+}
+
+func (c collections) DeviceChannels() *mongo.Collection {
+	return Database().Collection("device_channels")
+}
+
+func (c collections) StatsEvents() *mongo.Collection {
+	return Database().Collection("stats_events")
+}
+
+func (c collections) AuditEvents() *mongo.Collection {
+	return Database().Collection("audit_events")
+}
+
+func (c collections) Webhooks() *mongo.Collection {
+	return Database().Collection("webhooks")
+}
+
+func (c collections) WebhookDeliveries() *mongo.Collection {
+	return Database().Collection("webhook_deliveries")
+}
+
+func (c collections) CacheVersions() *mongo.Collection {
+	return Database().Collection("cache_versions")
+}
+
 func Collections() collections {
 	return collections{}
 }
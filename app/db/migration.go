@@ -2,12 +2,18 @@ package db
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/tanapoln/capgo-server/config"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const errCodeIndexOptionsConflict = 85
+
 func RunMigration() error {
 	ctx := context.Background()
 
@@ -24,5 +30,194 @@ func RunMigration() error {
 		return err
 	}
 
+	_, err = Collections().Releases().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "app_id", Value: 1},
+			{Key: "platform", Value: 1},
+			{Key: "targeting", Value: 1},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Indexes of keyset paginated lists. Every sort field is followed by _id, which is the tie breaker of the sort order.
+	_, err = Collections().Bundles().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "version_name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "sha256", Value: 1}}},
+		{Keys: bson.D{{Key: "storage_key", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().Releases().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "platform", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "version_name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "builtin_bundle_id", Value: 1}}},
+		{Keys: bson.D{{Key: "active_bundle_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().Channels().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "app_id", Value: 1},
+			{Key: "name", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().DeviceChannels().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "app_id", Value: 1},
+			{Key: "device_id", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().StatsEvents().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "app_id", Value: 1},
+			{Key: "version_name", Value: 1},
+			{Key: "action", Value: 1},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := createTTLIndex(ctx, Collections().StatsEvents(), config.Get().StatsRetention); err != nil {
+		return err
+	}
+
+	_, err = Collections().Apps().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "app_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().ApiTokens().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().AuditEvents().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "app_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "targets.id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().Webhooks().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "app_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Collections().WebhookDeliveries().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := createTTLIndex(ctx, Collections().WebhookDeliveries(), config.Get().WebhookDeliveryRetention); err != nil {
+		return err
+	}
+
+	if err := registerExistingApps(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// registerExistingApps registers every app id used by bundles, releases and channels created before apps were introduced.
+// Existing apps are left untouched.
+func registerExistingApps(ctx context.Context) error {
+	appIDs := map[string]struct{}{}
+	for _, coll := range []*mongo.Collection{Collections().Bundles(), Collections().Releases(), Collections().Channels()} {
+		values, err := coll.Distinct(ctx, "app_id", bson.M{})
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if s, ok := v.(string); ok && s != "" {
+				appIDs[s] = struct{}{}
+			}
+		}
+	}
+
+	now := time.Now()
+	for appID := range appIDs {
+		_, err := Collections().Apps().UpdateOne(
+			ctx,
+			bson.M{"app_id": appID},
+			bson.M{
+				"$setOnInsert": bson.M{
+					"_id":        primitive.NewObjectID(),
+					"name":       appID,
+					"platforms":  []Platform{},
+					"updated_at": now,
+					"created_at": now,
+				},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// createTTLIndex creates a TTL index on created_at of the collection. If the index already exists with a different retention,
+// the retention is updated in place.
+func createTTLIndex(ctx context.Context, coll *mongo.Collection, retention time.Duration) error {
+	expireAfter := int32(retention.Seconds())
+	keys := bson.D{{Key: "created_at", Value: 1}}
+
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetExpireAfterSeconds(expireAfter),
+	})
+	if err == nil {
+		return nil
+	}
+
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != errCodeIndexOptionsConflict {
+		return err
+	}
+
+	return Database().RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: coll.Name()},
+		{Key: "index", Value: bson.D{
+			{Key: "keyPattern", Value: keys},
+			{Key: "expireAfterSeconds", Value: expireAfter},
+		}},
+	}).Err()
+}
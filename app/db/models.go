@@ -2,22 +2,209 @@ package db
 
 import (
 	"errors"
+	"slices"
 	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Organization is a team that owns apps. API tokens of an organization can only access its apps.
+type Organization struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+type Permission string
+
+const (
+	// PermissionRead allows listing and viewing bundles, releases, channels and stats.
+	PermissionRead Permission = "read"
+	// PermissionUpload allows uploading and re-signing bundles.
+	PermissionUpload Permission = "upload"
+	// PermissionRelease allows managing releases, rollouts and channels.
+	PermissionRelease Permission = "release"
+	// PermissionAdmin allows everything in the organization, including managing apps and API tokens.
+	PermissionAdmin Permission = "admin"
+)
+
+func ParsePermission(val string) (Permission, error) {
+	switch p := Permission(strings.TrimSpace(strings.ToLower(val))); p {
+	case PermissionRead, PermissionUpload, PermissionRelease, PermissionAdmin:
+		return p, nil
+	default:
+		return "", errors.New("invalid permission: " + val)
+	}
+}
+
+// ApiToken is a management API token of an organization. Only a hash of the token is stored.
+type ApiToken struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	OrgID primitive.ObjectID `bson:"org_id"`
+	Name  string             `bson:"name"`
+	// TokenHash is a hex encoded SHA-256 of the token.
+	TokenHash string `bson:"token_hash"`
+	// Prefix is the beginning of the token for recognizing it, e.g. in a token list.
+	Prefix string `bson:"prefix"`
+	// AppIDs limits the token to some apps of the organization. Empty allows every app of the organization.
+	AppIDs      []string     `bson:"app_ids"`
+	Permissions []Permission `bson:"permissions"`
+	ExpiresAt   *time.Time   `bson:"expires_at,omitempty"`
+	CreatedAt   time.Time    `bson:"created_at"`
+}
+
+// App is a registered Capacitor app. Bundles, releases and channels belong to an app by its AppID.
+type App struct {
+	ID primitive.ObjectID `bson:"_id"`
+	// OrgID is the organization that owns the app. Nil if the app is not owned by any organization,
+	// then it's only accessible by superadmins.
+	OrgID *primitive.ObjectID `bson:"org_id,omitempty"`
+	// AppID is the app bundle name reported by Capgo plugin, e.g. com.example.app.
+	AppID string `bson:"app_id"`
+	Name  string `bson:"name"`
+	// Platforms that releases can be created for. Empty allows every platform.
+	Platforms []Platform `bson:"platforms"`
+
+	// SigningPrivateKey and EncryptionPrivateKey override the server-wide bundle keys for this app.
+	// Each is a PEM encoded private key. Empty uses the server-wide key.
+	SigningPrivateKey    string `bson:"signing_private_key,omitempty"`
+	EncryptionPrivateKey string `bson:"encryption_private_key,omitempty"`
+
+	// DefaultChannel is used when neither the device nor the plugin config provides a channel.
+	DefaultChannel string `bson:"default_channel,omitempty"`
+
+	// Retention is a policy for cleaning up old bundles. Nil keeps every bundle.
+	Retention *RetentionPolicy `bson:"retention,omitempty"`
+
+	UpdatedAt time.Time `bson:"updated_at"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// AllowsPlatform reports whether releases of the platform can be created for the app.
+func (a App) AllowsPlatform(platform Platform) bool {
+	if len(a.Platforms) == 0 {
+		return true
+	}
+	for _, p := range a.Platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// RetentionPolicy decides which bundles of an app are kept. A bundle is kept if it matches any condition,
+// and bundles referenced by a release or a channel are always kept. Zero disables a condition.
+type RetentionPolicy struct {
+	// KeepLast keeps the latest N bundles.
+	KeepLast int `bson:"keep_last"`
+	// KeepDays keeps bundles newer than N days.
+	KeepDays int `bson:"keep_days"`
+}
+
 type Bundle struct {
 	ID          primitive.ObjectID `bson:"_id"`
 	AppID       string             `bson:"app_id"`
 	VersionName string             `bson:"version_name"`
 	Description string             `bson:"description"`
 	CRC         string             `bson:"crc_checksum"`
+	// SHA256 is a hex encoded SHA-256 of the uploaded bundle file, used for finding identical uploads.
+	// Empty if the bundle was uploaded before deduplication.
+	SHA256 string `bson:"sha256,omitempty"`
+	// SHA256Checksum is a hex encoded SHA-256 of the original bundle zip file, verified by newer Capgo plugins after
+	// downloading and decrypting the bundle. Empty if unknown, then CRC is returned to every plugin.
+	SHA256Checksum string `bson:"sha256_checksum,omitempty"`
+	// Size is the size of the stored object in bytes. Zero if unknown.
+	Size int64 `bson:"size,omitempty"`
+	// ContentType is the MIME type of the stored object, e.g. application/zip, or application/octet-stream when encrypted.
+	ContentType string `bson:"content_type,omitempty"`
+	// Validation is a report of validating the bundle zip file on upload. Nil if the bundle was uploaded before validation.
+	Validation *BundleValidationReport `bson:"validation,omitempty"`
+	// AliasOf is the bundle this bundle was deduplicated to. An alias is an identical bundle uploaded with another
+	// version name, sharing the stored object and the signature of the original. Nil if the bundle is not an alias.
+	AliasOf *primitive.ObjectID `bson:"alias_of,omitempty"`
 	//Signature is a signature of the bundle, signed with SHA512 RSA public key that configured in the app. Can be empty if not use
-	Signature         string    `bson:"signature"`
-	PublicDownloadURL string    `bson:"public_download_url"` //a quick MVP solution for capgo
+	Signature string `bson:"signature"`
+	// SignedAt is when the signature was created. Nil if the bundle is not signed.
+	SignedAt *time.Time `bson:"signed_at,omitempty"`
+	// SigningKeyFingerprint identifies the server or app key the bundle is signed with. Empty if the bundle is not signed
+	// by the server, or was signed before fingerprints were stored.
+	SigningKeyFingerprint string `bson:"signing_key_fingerprint,omitempty"`
+	// Encryption holds the session key of an encrypted bundle. Nil if the bundle is not encrypted.
+	Encryption *BundleEncryption `bson:"encryption,omitempty"`
+	// EncryptionKeyFingerprint identifies the server or app key the bundle is encrypted with. Empty if the bundle is not
+	// encrypted by the server, or was encrypted before fingerprints were stored.
+	EncryptionKeyFingerprint string `bson:"encryption_key_fingerprint,omitempty"`
+	// StorageKey is an object key of the bundle zip file in the bundle storage.
+	StorageKey        string    `bson:"storage_key"`
+	PublicDownloadURL string    `bson:"public_download_url"` //a quick MVP solution for capgo. Only set when bundles are uploaded as public objects.
 	CreatedAt         time.Time `bson:"created_at"`
+	// DeletedAt is when the bundle was deleted. A deleted bundle can be restored until it's purged together with its
+	// stored object. Nil if the bundle is not deleted.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+}
+
+type BundleValidationSeverity string
+
+const (
+	// BundleValidationError rejects the upload.
+	BundleValidationError BundleValidationSeverity = "error"
+	// BundleValidationWarning is only reported.
+	BundleValidationWarning BundleValidationSeverity = "warning"
+)
+
+type BundleValidationReport struct {
+	// Inspected is false if the bundle is encrypted by Capgo CLI, then only its size is validated.
+	Inspected        bool                    `bson:"inspected"`
+	Files            int                     `bson:"files"`
+	CompressedSize   int64                   `bson:"compressed_size"`
+	UncompressedSize int64                   `bson:"uncompressed_size"`
+	Issues           []BundleValidationIssue `bson:"issues"`
+	// Errors is the number of error issues, including the ones not kept in Issues.
+	Errors int `bson:"errors"`
+	// Truncated is true if there were more issues than kept in Issues.
+	Truncated   bool      `bson:"truncated"`
+	ValidatedAt time.Time `bson:"validated_at"`
+}
+
+func (r BundleValidationReport) HasErrors() bool {
+	if r.Errors > 0 {
+		return true
+	}
+	// Reports stored before Errors was counted.
+	for _, issue := range r.Issues {
+		if issue.Severity == BundleValidationError {
+			return true
+		}
+	}
+	return false
+}
+
+type BundleValidationIssue struct {
+	// Check is the name of the check that found the issue, e.g. index_html or path_traversal.
+	Check    string                   `bson:"check"`
+	Severity BundleValidationSeverity `bson:"severity"`
+	// Path is the file in the zip the issue is about. Empty if the issue is about the whole bundle.
+	Path    string `bson:"path,omitempty"`
+	Message string `bson:"message"`
+}
+
+type BundleEncryption struct {
+	// IV is a base64 encoded AES IV.
+	IV string `bson:"iv"`
+	// WrappedKey is a base64 encoded AES key, encrypted with the RSA private key.
+	WrappedKey string `bson:"wrapped_key"`
+}
+
+// SessionKey returns the session key in the format expected by Capgo plugin.
+func (e *BundleEncryption) SessionKey() string {
+	if e == nil {
+		return ""
+	}
+	return e.IV + ":" + e.WrappedKey
 }
 
 type Release struct {
@@ -36,15 +223,297 @@ type Release struct {
 	VersionCode  string     `bson:"version_code"`
 	ReleasedDate *time.Time `bson:"released_date"`
 
+	// Targeting extends the release to other native builds than its exact version name and version code.
+	// Nil if the release only matches the exact build.
+	Targeting *ReleaseTargeting `bson:"targeting,omitempty"`
+
 	// BuiltinBundleID is a bundle ID that's already embedded into released executable.
 	BuiltinBundleID primitive.ObjectID `bson:"builtin_bundle_id"`
 	// ActiveBundleID is a bundle ID that's app must be used.
 	ActiveBundleID *primitive.ObjectID `bson:"active_bundle_id"`
 
+	// PreviousActiveBundleID is the active bundle before the current one. It's a target of automatic rollback.
+	PreviousActiveBundleID *primitive.ObjectID `bson:"previous_active_bundle_id,omitempty"`
+	// ActiveBundleSetAt is when the active bundle was changed the last time.
+	ActiveBundleSetAt *time.Time `bson:"active_bundle_set_at,omitempty"`
+	// ActiveBundleHistory is the list of active bundle changes, oldest first. Only the latest MaxActiveBundleHistory
+	// changes are kept.
+	ActiveBundleHistory []ActiveBundleChange `bson:"active_bundle_history,omitempty"`
+
+	// Rollout is a staged rollout of a new bundle to a percentage of devices. Nil if never rolled out.
+	Rollout *Rollout `bson:"rollout,omitempty"`
+
+	// Superseded is set when the release is replaced by a newer native version. Devices are asked to update the app
+	// from the app store instead of receiving a bundle. Nil if the release is not superseded.
+	Superseded *ReleaseSupersede `bson:"superseded,omitempty"`
+
+	// AutoRollback is a policy for reverting the active bundle when its failure rate is too high. Nil if disabled.
+	AutoRollback *AutoRollbackPolicy `bson:"auto_rollback,omitempty"`
+	// LastRollback is a record of the latest automatic rollback.
+	LastRollback *RollbackRecord `bson:"last_rollback,omitempty"`
+
 	UpdatedAt time.Time `bson:"updated_at"`
 	CreatedAt time.Time `bson:"created_at"`
 }
 
+const MaxActiveBundleHistory = 50
+
+type ActiveBundleChange struct {
+	// BundleID is the new active bundle. Nil when the release is reverted to its builtin bundle.
+	BundleID *primitive.ObjectID `bson:"bundle_id"`
+	At       time.Time           `bson:"at"`
+}
+
+// ReleaseTargeting is a rule for matching native builds. Every set condition must match.
+type ReleaseTargeting struct {
+	// VersionRange is a semver range of the version name, e.g. ">=2.3.0 <3.0.0". "*" matches every version name.
+	VersionRange string `bson:"version_range,omitempty"`
+	// MinVersionCode and MaxVersionCode are inclusive bounds of a numeric version code.
+	MinVersionCode *int64 `bson:"min_version_code,omitempty"`
+	MaxVersionCode *int64 `bson:"max_version_code,omitempty"`
+}
+
+type ReleaseSupersede struct {
+	// Version is the newer native version that users should update to.
+	Version string `bson:"version"`
+	// Message is shown to the user, e.g. "Please update the app from the store".
+	Message string    `bson:"message"`
+	At      time.Time `bson:"at"`
+}
+
+type AutoRollbackPolicy struct {
+	Enabled bool `bson:"enabled"`
+	// FailureRateThreshold is a ratio (0-1) of failure events to set and failure events. The bundle is rolled back when it's exceeded.
+	FailureRateThreshold float64 `bson:"failure_rate_threshold"`
+	// MinEvents is a minimum number of set and failure events before the failure rate is evaluated.
+	MinEvents int64 `bson:"min_events"`
+}
+
+type RollbackRecord struct {
+	FromBundleID primitive.ObjectID  `bson:"from_bundle_id"`
+	ToBundleID   *primitive.ObjectID `bson:"to_bundle_id"`
+	FailureRate  float64             `bson:"failure_rate"`
+	Failures     int64               `bson:"failures"`
+	Sets         int64               `bson:"sets"`
+	Reason       string              `bson:"reason"`
+	At           time.Time           `bson:"at"`
+}
+
+type RolloutStatus string
+
+const (
+	// RolloutStatusActive serves the rollout bundle to devices within the percentage, and the fallback bundle to the others.
+	RolloutStatusActive RolloutStatus = "active"
+	// RolloutStatusPaused freezes the percentage: devices within it keep the rollout bundle, and the others keep the
+	// fallback bundle until the rollout is advanced again.
+	RolloutStatusPaused RolloutStatus = "paused"
+	// RolloutStatusAborted ends the rollout. The fallback bundle becomes the active bundle of the release.
+	RolloutStatusAborted RolloutStatus = "aborted"
+	// RolloutStatusCompleted ends the rollout at 100%. The rollout bundle becomes the active bundle of the release.
+	RolloutStatusCompleted RolloutStatus = "completed"
+)
+
+type Rollout struct {
+	BundleID         primitive.ObjectID `bson:"bundle_id"`
+	FallbackBundleID primitive.ObjectID `bson:"fallback_bundle_id"`
+	// Percentage is a percentage of devices (0-100) that receive the rollout bundle.
+	Percentage int           `bson:"percentage"`
+	Status     RolloutStatus `bson:"status"`
+	StartedAt  time.Time     `bson:"started_at"`
+	UpdatedAt  time.Time     `bson:"updated_at"`
+}
+
+func (r *Rollout) IsRunning() bool {
+	return r != nil && (r.Status == RolloutStatusActive || r.Status == RolloutStatusPaused)
+}
+
+// Channel is a named distribution track of an app (e.g. production, beta, internal).
+// Devices on a channel receive the channel's bundle for their release instead of the release's active bundle.
+type Channel struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	AppID string             `bson:"app_id"`
+	Name  string             `bson:"name"`
+
+	// AllowDeviceSelfSet allows devices to assign themselves to this channel via `/channel_self`.
+	AllowDeviceSelfSet bool `bson:"allow_device_self_set"`
+
+	// Bundles is a list of bundles per release. A release without an entry falls back to its active bundle.
+	Bundles []ChannelBundle `bson:"bundles"`
+
+	UpdatedAt time.Time `bson:"updated_at"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (c Channel) BundleIDForRelease(releaseID primitive.ObjectID) (primitive.ObjectID, bool) {
+	for _, b := range c.Bundles {
+		if b.ReleaseID == releaseID {
+			return b.BundleID, true
+		}
+	}
+	return primitive.NilObjectID, false
+}
+
+type ChannelBundle struct {
+	ReleaseID primitive.ObjectID `bson:"release_id"`
+	BundleID  primitive.ObjectID `bson:"bundle_id"`
+}
+
+// DeviceChannel is a channel assignment of a device, made by the device itself via `/channel_self`.
+type DeviceChannel struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	AppID     string             `bson:"app_id"`
+	DeviceID  string             `bson:"device_id"`
+	Channel   string             `bson:"channel"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// StatsEvent is an event reported by Capgo plugin via `/stats`.
+type StatsEvent struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	AppID    string             `bson:"app_id"`
+	DeviceID string             `bson:"device_id"`
+	CustomID string             `bson:"custom_id,omitempty"`
+	Platform Platform           `bson:"platform"`
+
+	// Action is a Capgo stats action, e.g. set, download_complete, download_fail, update_fail, app_moved_to_background.
+	Action string `bson:"action"`
+	// VersionName is the bundle version name that the event is about.
+	VersionName    string `bson:"version_name"`
+	OldVersionName string `bson:"old_version_name,omitempty"`
+
+	VersionBuild  string `bson:"version_build"`
+	VersionCode   string `bson:"version_code"`
+	VersionOS     string `bson:"version_os"`
+	PluginVersion string `bson:"plugin_version"`
+	IsEmulator    bool   `bson:"is_emulator"`
+	IsProd        bool   `bson:"is_prod"`
+
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// AuditEvent records a change made through the management API, or by the server itself, e.g. an automatic rollback.
+type AuditEvent struct {
+	ID primitive.ObjectID `bson:"_id"`
+	// Action is the management API name of the change, e.g. releases.set-active.
+	Action string     `bson:"action"`
+	Actor  AuditActor `bson:"actor"`
+
+	OrgID *primitive.ObjectID `bson:"org_id"`
+	AppID string              `bson:"app_id"`
+	// Targets are the documents affected by the change. The first one is the main target.
+	Targets []AuditTarget `bson:"targets"`
+
+	// Before and After are snapshots of the main target. Before is empty for creation and After is empty for deletion.
+	Before bson.Raw `bson:"before,omitempty"`
+	After  bson.Raw `bson:"after,omitempty"`
+
+	RequestID string    `bson:"request_id"`
+	ClientIP  string    `bson:"client_ip"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+type AuditActor struct {
+	// Kind is static_key, api_token, oauth or system.
+	Kind string `bson:"kind"`
+	// Subject is a fingerprint of a static key, an API token id or an OIDC subject.
+	Subject string `bson:"subject"`
+}
+
+type AuditTargetType string
+
+const (
+	AuditTargetOrganization    AuditTargetType = "organization"
+	AuditTargetApiToken        AuditTargetType = "api_token"
+	AuditTargetApp             AuditTargetType = "app"
+	AuditTargetBundle          AuditTargetType = "bundle"
+	AuditTargetRelease         AuditTargetType = "release"
+	AuditTargetChannel         AuditTargetType = "channel"
+	AuditTargetWebhook         AuditTargetType = "webhook"
+	AuditTargetWebhookDelivery AuditTargetType = "webhook_delivery"
+)
+
+type AuditTarget struct {
+	Type AuditTargetType `bson:"type"`
+	ID   string          `bson:"id"`
+}
+
+// Webhook is an endpoint of an app that receives signed JSON payloads of lifecycle events.
+type Webhook struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	AppID string             `bson:"app_id"`
+	URL   string             `bson:"url"`
+	// Secret is the HMAC key of payload signatures.
+	Secret string `bson:"secret"`
+	// Events the webhook subscribes to. Empty subscribes to every event.
+	Events    []WebhookEvent `bson:"events"`
+	Enabled   bool           `bson:"enabled"`
+	UpdatedAt time.Time      `bson:"updated_at"`
+	CreatedAt time.Time      `bson:"created_at"`
+}
+
+func (w Webhook) Subscribes(event WebhookEvent) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+type WebhookEvent string
+
+const (
+	WebhookEventBundleUploaded        WebhookEvent = "bundle.uploaded"
+	WebhookEventReleaseCreated        WebhookEvent = "release.created"
+	WebhookEventReleaseDeleted        WebhookEvent = "release.deleted"
+	WebhookEventActiveBundleChanged   WebhookEvent = "release.active_bundle_changed"
+	WebhookEventRolloutAdvanced       WebhookEvent = "rollout.advanced"
+	WebhookEventAutoRollbackTriggered WebhookEvent = "release.auto_rollback_triggered"
+)
+
+func ParseWebhookEvent(val string) (WebhookEvent, error) {
+	switch e := WebhookEvent(strings.TrimSpace(strings.ToLower(val))); e {
+	case WebhookEventBundleUploaded, WebhookEventReleaseCreated, WebhookEventReleaseDeleted, WebhookEventActiveBundleChanged,
+		WebhookEventRolloutAdvanced, WebhookEventAutoRollbackTriggered:
+		return e, nil
+	default:
+		return "", errors.New("invalid webhook event: " + val)
+	}
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a queued delivery of an event to a webhook, and the log of its attempts.
+type WebhookDelivery struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	WebhookID primitive.ObjectID `bson:"webhook_id"`
+	AppID     string             `bson:"app_id"`
+	Event     WebhookEvent       `bson:"event"`
+	// Payload is the JSON body. It's kept as sent, so every attempt has the same signature input.
+	Payload string `bson:"payload"`
+
+	Status   WebhookDeliveryStatus `bson:"status"`
+	Attempts int                   `bson:"attempts"`
+	// NextAttemptAt is when a worker may pick up the delivery. A worker leases the delivery by moving it forward.
+	NextAttemptAt  time.Time  `bson:"next_attempt_at"`
+	LastAttemptAt  *time.Time `bson:"last_attempt_at,omitempty"`
+	LastStatusCode int        `bson:"last_status_code,omitempty"`
+	LastError      string     `bson:"last_error,omitempty"`
+
+	UpdatedAt time.Time `bson:"updated_at"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// CacheVersion is a shared version of a process-local cache. It's incremented whenever the cached data is modified,
+// and every server replica flushes its local cache when it sees a new version.
+type CacheVersion struct {
+	ID        string    `bson:"_id"`
+	Version   int64     `bson:"version"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
 type Platform string
 
 const (
@@ -3,6 +3,7 @@ package s3ext
 import (
 	"context"
 	"log"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -11,11 +12,8 @@ import (
 	"github.com/tanapoln/capgo-server/config"
 )
 
-var (
-	Client *s3.Client
-)
-
-func init() {
+// Client is the S3 client, created on first use.
+var Client = sync.OnceValue(func() *s3.Client {
 	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
 	if err != nil {
 		log.Fatal(err)
@@ -30,9 +28,13 @@ func init() {
 	}
 
 	// Create an Amazon S3 service client
-	Client = s3.NewFromConfig(cfg, s3Opts...)
-}
+	return s3.NewFromConfig(cfg, s3Opts...)
+})
 
 func NewUploader() *manager.Uploader {
-	return manager.NewUploader(Client)
+	return manager.NewUploader(Client())
+}
+
+func NewPresignClient() *s3.PresignClient {
+	return s3.NewPresignClient(Client())
 }
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/config"
+)
+
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+var (
+	ErrObjectNotFound          = errors.New("object is not found")
+	ErrDownloadURLNotSupported = errors.New("storage does not support direct download url")
+	ErrInvalidKey              = errors.New("invalid object key")
+)
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// BundleStorage stores bundle zip files by key.
+type BundleStorage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens an object. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List calls fn for every object whose key starts with prefix, stopping at the first error returned by fn.
+	// An empty prefix lists every object in the storage.
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// DownloadURL returns a url that devices can download the object from directly, valid for at least ttl.
+	// It returns ErrDownloadURLNotSupported if the object must be served by capgo-server itself.
+	DownloadURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultStorage BundleStorage
+	defaultErr     error
+)
+
+// Default returns the bundle storage of the configured backend.
+func Default() (BundleStorage, error) {
+	defaultOnce.Do(func() {
+		defaultStorage, defaultErr = New(config.Get())
+	})
+	return defaultStorage, defaultErr
+}
+
+func New(cfg config.Config) (BundleStorage, error) {
+	switch cfg.StorageBackend {
+	case BackendS3, "":
+		return NewS3Storage(cfg.S3Bucket, cfg.BundleDownloadURLMode == "public")
+	case BackendLocal:
+		return NewLocalStorage(cfg.LocalStorageDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
 	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/httpstats"
 	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/ratelimit"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/requestid"
 	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/spa"
+	"github.com/tanapoln/capgo-server/app/db"
 	"github.com/tanapoln/capgo-server/config"
 	"golang.org/x/time/rate"
 )
@@ -20,6 +22,7 @@ func InitRouter() *gin.Engine {
 	router.SetTrustedProxies(config.Get().TrustedProxies)
 
 	router.Use(httpstats.NewMiddleware())
+	router.Use(requestid.NewMiddleware())
 
 	capgo := router.Group("")
 	{
@@ -31,6 +34,7 @@ func InitRouter() *gin.Engine {
 
 		ctrl := capgoCtrl.NewCapgoController()
 		capgo.POST("/updates", updateLimit, ctrl.Updates)
+		capgo.GET("/bundles/:id/download", ctrl.DownloadBundle)
 		capgo.POST("/stats", ctrl.Stats)
 		capgo.POST("/channel_self", ctrl.RegisterChannel)
 		capgo.DELETE("/channel_self", ctrl.UnregisterChannel)
@@ -48,6 +52,7 @@ func InitMgmtRouter() *gin.Engine {
 	router.SetTrustedProxies(config.Get().TrustedProxies)
 
 	router.Use(httpstats.NewMiddleware())
+	router.Use(requestid.NewMiddleware())
 
 	mgmt := router.Group("/api/v1/")
 	{
@@ -57,14 +62,58 @@ func InitMgmtRouter() *gin.Engine {
 		}))
 
 		ctrl := mgmtCtrl.NewCapgoManagementController()
-		mgmt.GET("/bundles.list", ctrl.ListAllBundles)
-		mgmt.POST("/bundles.upload", ctrl.UploadBundle)
-
-		mgmt.GET("/releases.list", ctrl.ListAllReleases)
-		mgmt.POST("/releases.create", ctrl.CreateRelease)
-		mgmt.POST("/releases.update", ctrl.UpdateRelease)
-		mgmt.POST("/releases.set-active", ctrl.SetReleaseActiveBundle)
-		mgmt.POST("/releases.delete", ctrl.DeleteRelease)
+		mgmt.GET("/organizations.list", authn.Require(db.PermissionRead), ctrl.ListAllOrganizations)
+		mgmt.POST("/organizations.create", authn.RequireSuperadmin(), ctrl.CreateOrganization)
+		mgmt.POST("/organizations.delete", authn.RequireSuperadmin(), ctrl.DeleteOrganization)
+
+		mgmt.GET("/tokens.list", authn.Require(db.PermissionAdmin), ctrl.ListAllApiTokens)
+		mgmt.POST("/tokens.create", authn.Require(db.PermissionAdmin), ctrl.CreateApiToken)
+		mgmt.POST("/tokens.revoke", authn.Require(db.PermissionAdmin), ctrl.RevokeApiToken)
+
+		mgmt.GET("/apps.list", authn.Require(db.PermissionRead), ctrl.ListAllApps)
+		mgmt.POST("/apps.create", authn.Require(db.PermissionAdmin), ctrl.CreateApp)
+		mgmt.POST("/apps.update", authn.Require(db.PermissionAdmin), ctrl.UpdateApp)
+		mgmt.POST("/apps.delete", authn.Require(db.PermissionAdmin), ctrl.DeleteApp)
+
+		mgmt.GET("/bundles.list", authn.Require(db.PermissionRead), ctrl.ListAllBundles)
+		mgmt.GET("/bundles.get", authn.Require(db.PermissionRead), ctrl.GetBundle)
+		mgmt.POST("/bundles.upload", authn.Require(db.PermissionUpload), ctrl.UploadBundle)
+		mgmt.POST("/bundles.resign", authn.Require(db.PermissionUpload), ctrl.ResignBundles)
+		mgmt.POST("/bundles.delete", authn.Require(db.PermissionRelease), ctrl.DeleteBundle)
+		mgmt.POST("/bundles.restore", authn.Require(db.PermissionRelease), ctrl.RestoreBundle)
+
+		mgmt.GET("/releases.list", authn.Require(db.PermissionRead), ctrl.ListAllReleases)
+		mgmt.GET("/releases.get", authn.Require(db.PermissionRead), ctrl.GetRelease)
+		mgmt.POST("/releases.create", authn.Require(db.PermissionRelease), ctrl.CreateRelease)
+		mgmt.POST("/releases.update", authn.Require(db.PermissionRelease), ctrl.UpdateRelease)
+		mgmt.POST("/releases.set-active", authn.Require(db.PermissionRelease), ctrl.SetReleaseActiveBundle)
+		mgmt.POST("/releases.set-auto-rollback", authn.Require(db.PermissionRelease), ctrl.SetReleaseAutoRollback)
+		mgmt.POST("/releases.set-targeting", authn.Require(db.PermissionRelease), ctrl.SetReleaseTargeting)
+		mgmt.POST("/releases.supersede", authn.Require(db.PermissionRelease), ctrl.SupersedeRelease)
+		mgmt.POST("/releases.unsupersede", authn.Require(db.PermissionRelease), ctrl.UnsupersedeRelease)
+		mgmt.POST("/releases.delete", authn.Require(db.PermissionRelease), ctrl.DeleteRelease)
+
+		mgmt.POST("/rollouts.create", authn.Require(db.PermissionRelease), ctrl.CreateRollout)
+		mgmt.POST("/rollouts.advance", authn.Require(db.PermissionRelease), ctrl.AdvanceRollout)
+		mgmt.POST("/rollouts.pause", authn.Require(db.PermissionRelease), ctrl.PauseRollout)
+		mgmt.POST("/rollouts.abort", authn.Require(db.PermissionRelease), ctrl.AbortRollout)
+
+		mgmt.GET("/stats.bundles", authn.Require(db.PermissionRead), ctrl.ListBundleStats)
+
+		mgmt.GET("/webhooks.list", authn.Require(db.PermissionRead), ctrl.ListAllWebhooks)
+		mgmt.POST("/webhooks.create", authn.Require(db.PermissionAdmin), ctrl.CreateWebhook)
+		mgmt.POST("/webhooks.update", authn.Require(db.PermissionAdmin), ctrl.UpdateWebhook)
+		mgmt.POST("/webhooks.delete", authn.Require(db.PermissionAdmin), ctrl.DeleteWebhook)
+		mgmt.GET("/webhooks.deliveries", authn.Require(db.PermissionRead), ctrl.ListWebhookDeliveries)
+		mgmt.POST("/webhooks.redeliver", authn.Require(db.PermissionAdmin), ctrl.RedeliverWebhook)
+
+		mgmt.GET("/audit.list", authn.Require(db.PermissionRead), ctrl.ListAuditEvents)
+
+		mgmt.GET("/channels.list", authn.Require(db.PermissionRead), ctrl.ListAllChannels)
+		mgmt.POST("/channels.create", authn.Require(db.PermissionRelease), ctrl.CreateChannel)
+		mgmt.POST("/channels.update", authn.Require(db.PermissionRelease), ctrl.UpdateChannel)
+		mgmt.POST("/channels.set-bundle", authn.Require(db.PermissionRelease), ctrl.SetChannelBundle)
+		mgmt.POST("/channels.delete", authn.Require(db.PermissionRelease), ctrl.DeleteChannel)
 	}
 
 	router.GET("/_healthz", func(c *gin.Context) {
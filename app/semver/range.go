@@ -0,0 +1,321 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type operator string
+
+const (
+	opEQ operator = "="
+	opGT operator = ">"
+	opGE operator = ">="
+	opLT operator = "<"
+	opLE operator = "<="
+)
+
+type comparator struct {
+	op      operator
+	version Version
+}
+
+func (c comparator) matches(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case opEQ:
+		return cmp == 0
+	case opGT:
+		return cmp > 0
+	case opGE:
+		return cmp >= 0
+	case opLT:
+		return cmp < 0
+	case opLE:
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+// Range is a version range in npm style. Comparators separated by spaces must all match, and sets separated by "||"
+// are alternatives, e.g. ">=2.3.0 <3.0.0 || >=4.0.0". Caret (^2.3.0), tilde (~2.3.0) and wildcards (2.x, 2.3.*, *)
+// are supported as well. Like npm, a partial version is a wildcard, so "2" is 2.x rather than 2.0.0.
+type Range struct {
+	raw  string
+	sets [][]comparator
+}
+
+func ParseRange(s string) (Range, error) {
+	r := Range{raw: strings.TrimSpace(s)}
+	if r.raw == "" {
+		return Range{}, fmt.Errorf("empty version range")
+	}
+
+	for _, set := range strings.Split(r.raw, "||") {
+		fields := strings.Fields(set)
+		if len(fields) == 0 {
+			return Range{}, fmt.Errorf("invalid version range %q: empty set", s)
+		}
+
+		var comparators []comparator
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Allow a space between an operator and its version, e.g. ">= 2.3.0".
+			if isOperator(field) && i+1 < len(fields) {
+				field += fields[i+1]
+				i++
+			}
+			cs, err := parseComparator(field)
+			if err != nil {
+				return Range{}, fmt.Errorf("invalid version range %q: %w", s, err)
+			}
+			comparators = append(comparators, cs...)
+		}
+		r.sets = append(r.sets, comparators)
+	}
+	return r, nil
+}
+
+func (r Range) String() string {
+	return r.raw
+}
+
+// Contains reports whether the version is in the range.
+func (r Range) Contains(v Version) bool {
+	for _, set := range r.sets {
+		if matchesAll(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the narrowest alternative of the range that contains the version.
+func (r Range) Match(v Version) (Interval, bool) {
+	var best Interval
+	found := false
+	for _, set := range r.sets {
+		if !matchesAll(set, v) {
+			continue
+		}
+		if i := intervalOf(set); !found || i.Compare(best) < 0 {
+			best = i
+			found = true
+		}
+	}
+	return best, found
+}
+
+// MatchesAll reports whether an alternative of the range matches every version, e.g. "*".
+func (r Range) MatchesAll() bool {
+	for _, set := range r.sets {
+		if len(set) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(set []comparator, v Version) bool {
+	for _, c := range set {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Interval is the versions between the bounds of an alternative of a range. A nil bound is unbounded.
+type Interval struct {
+	Lower *Version
+	Upper *Version
+}
+
+func intervalOf(set []comparator) Interval {
+	var i Interval
+	for _, c := range set {
+		v := c.version
+		if c.op == opEQ || c.op == opGT || c.op == opGE {
+			if i.Lower == nil || v.Compare(*i.Lower) > 0 {
+				i.Lower = &v
+			}
+		}
+		if c.op == opEQ || c.op == opLT || c.op == opLE {
+			if i.Upper == nil || v.Compare(*i.Upper) < 0 {
+				i.Upper = &v
+			}
+		}
+	}
+	return i
+}
+
+// Compare returns -1, 0 or 1 if i is narrower than, as wide as or wider than o. An interval with fewer unbounded sides
+// is narrower. Bounded intervals are compared by the distance between their bounds, so 2.3.0 is narrower than 2.3.x,
+// which is narrower than ^2.3.0, which is narrower than 2.x. Intervals unbounded on the same side are compared by their
+// other bound, e.g. >=2.3.0 is narrower than >=2.0.0.
+func (i Interval) Compare(o Interval) int {
+	if c := compareInt(i.unboundedSides(), o.unboundedSides()); c != 0 {
+		return c
+	}
+	switch {
+	case i.Lower != nil && i.Upper != nil:
+		iw, ow := i.width(), o.width()
+		for k := range iw {
+			if c := compareInt(iw[k], ow[k]); c != 0 {
+				return c
+			}
+		}
+	case i.Lower != nil && o.Lower != nil:
+		return o.Lower.Compare(*i.Lower)
+	case i.Upper != nil && o.Upper != nil:
+		return i.Upper.Compare(*o.Upper)
+	}
+	return 0
+}
+
+func (i Interval) unboundedSides() int64 {
+	var n int64
+	if i.Lower == nil {
+		n++
+	}
+	if i.Upper == nil {
+		n++
+	}
+	return n
+}
+
+// width is the distance between the bounds, compared part by part, e.g. ^2.3.0 is 1.-3.0 and 2.x is 1.0.0.
+func (i Interval) width() [3]int64 {
+	return [3]int64{i.Upper.Major - i.Lower.Major, i.Upper.Minor - i.Lower.Minor, i.Upper.Patch - i.Lower.Patch}
+}
+
+func isOperator(s string) bool {
+	switch operator(s) {
+	case opEQ, opGT, opGE, opLT, opLE:
+		return true
+	default:
+		return s == "^" || s == "~"
+	}
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	switch {
+	case strings.HasPrefix(s, "^"):
+		return parseCaret(s[1:])
+	case strings.HasPrefix(s, "~"):
+		return parseTilde(s[1:])
+	}
+
+	op := opEQ
+	for _, candidate := range []operator{opGE, opLE, opGT, opLT, opEQ} {
+		if strings.HasPrefix(s, string(candidate)) {
+			op = candidate
+			s = s[len(candidate):]
+			break
+		}
+	}
+
+	if isWildcard(s) {
+		return parseWildcard(op, s)
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return []comparator{{op: op, version: v}}, nil
+}
+
+// parseWildcard expands a partial version, e.g. "2.x" is ">=2.0.0 <3.0.0". "*" matches every version.
+func parseWildcard(op operator, s string) ([]comparator, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	var nums []int64
+	for _, p := range parts {
+		if p == "*" || p == "x" || p == "X" {
+			break
+		}
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		nums = append(nums, n)
+	}
+
+	if len(nums) == 0 {
+		if op == opLT || op == opGT {
+			// Nothing is lower or greater than every version.
+			return []comparator{{op: opLT, version: Version{}}}, nil
+		}
+		return nil, nil
+	}
+
+	lower := Version{Major: nums[0]}
+	upper := Version{Major: nums[0] + 1}
+	if len(nums) > 1 {
+		lower.Minor = nums[1]
+		upper = Version{Major: nums[0], Minor: nums[1] + 1}
+	}
+
+	switch op {
+	case opGT:
+		return []comparator{{op: opGE, version: upper}}, nil
+	case opGE:
+		return []comparator{{op: opGE, version: lower}}, nil
+	case opLT:
+		return []comparator{{op: opLT, version: lower}}, nil
+	case opLE:
+		return []comparator{{op: opLT, version: upper}}, nil
+	default:
+		return []comparator{{op: opGE, version: lower}, {op: opLT, version: upper}}, nil
+	}
+}
+
+func parseCaret(s string) ([]comparator, error) {
+	v, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	var upper Version
+	switch {
+	case v.Major > 0 || precision(s) == 1:
+		upper = Version{Major: v.Major + 1}
+	case v.Minor > 0 || precision(s) == 2:
+		upper = Version{Minor: v.Minor + 1}
+	default:
+		upper = Version{Patch: v.Patch + 1}
+	}
+	return []comparator{{op: opGE, version: v}, {op: opLT, version: upper}}, nil
+}
+
+func parseTilde(s string) ([]comparator, error) {
+	v, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	upper := Version{Major: v.Major, Minor: v.Minor + 1}
+	if precision(s) == 1 {
+		upper = Version{Major: v.Major + 1}
+	}
+	return []comparator{{op: opGE, version: v}, {op: opLT, version: upper}}, nil
+}
+
+// isWildcard reports whether s is a wildcard or a partial version, e.g. "2.x" or "2".
+func isWildcard(s string) bool {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	for _, p := range parts {
+		if p == "*" || p == "x" || p == "X" {
+			return true
+		}
+	}
+	return len(parts) < 3 && !strings.ContainsAny(s, "-+")
+}
+
+// precision is the number of version parts given, e.g. 2 for "2.3".
+func precision(s string) int {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	return len(strings.Split(s, "."))
+}
@@ -0,0 +1,154 @@
+package semver
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "*"},
+		{input: "2"},
+		{input: "2.3"},
+		{input: "2.x"},
+		{input: "2.3.*"},
+		{input: "2.3.0"},
+		{input: "v2.3.0"},
+		{input: "^2.3.0"},
+		{input: "~2.3.0"},
+		{input: ">=2.0.0 <3.0.0"},
+		{input: ">= 2.0.0 < 3.0.0"},
+		{input: ">=2.3.0 <3.0.0 || >=4.0.0"},
+		{input: "2.3.0-beta.1"},
+		{input: "", wantErr: true},
+		{input: "   ", wantErr: true},
+		{input: "2.3.0 ||", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: ">=2.a", wantErr: true},
+		{input: "^x", wantErr: true},
+		{input: "1.2.3.4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		{rng: "*", version: "0.0.1", want: true},
+		{rng: "*", version: "99.0.0", want: true},
+		{rng: "2", version: "2.0.0", want: true},
+		{rng: "2", version: "2.9.9", want: true},
+		{rng: "2", version: "3.0.0", want: false},
+		{rng: "2", version: "1.9.9", want: false},
+		{rng: "2.3", version: "2.3.7", want: true},
+		{rng: "2.3", version: "2.4.0", want: false},
+		{rng: "2.x", version: "2.5.0", want: true},
+		{rng: "2.x", version: "3.0.0", want: false},
+		{rng: "2.3.*", version: "2.3.9", want: true},
+		{rng: "2.3.*", version: "2.4.0", want: false},
+		{rng: "2.3.0", version: "2.3.0", want: true},
+		{rng: "2.3.0", version: "2.3.1", want: false},
+		{rng: "^2.3.0", version: "2.9.0", want: true},
+		{rng: "^2.3.0", version: "2.2.9", want: false},
+		{rng: "^2.3.0", version: "3.0.0", want: false},
+		{rng: "^0.2.3", version: "0.2.9", want: true},
+		{rng: "^0.2.3", version: "0.3.0", want: false},
+		{rng: "^0.0.3", version: "0.0.4", want: false},
+		{rng: "^2", version: "2.9.0", want: true},
+		{rng: "^0", version: "0.9.0", want: true},
+		{rng: "~2.3.0", version: "2.3.9", want: true},
+		{rng: "~2.3.0", version: "2.4.0", want: false},
+		{rng: "~2", version: "2.9.0", want: true},
+		{rng: "~2", version: "3.0.0", want: false},
+		{rng: ">=2.0.0 <3.0.0", version: "2.0.0", want: true},
+		{rng: ">=2.0.0 <3.0.0", version: "3.0.0", want: false},
+		{rng: ">2.3.0", version: "2.3.0", want: false},
+		{rng: ">2.3", version: "2.3.9", want: false},
+		{rng: ">2.3", version: "2.4.0", want: true},
+		{rng: "<=2.3", version: "2.3.9", want: true},
+		{rng: "<2.3", version: "2.3.0", want: false},
+		{rng: ">=2.3.0 <3.0.0 || >=4.0.0", version: "3.5.0", want: false},
+		{rng: ">=2.3.0 <3.0.0 || >=4.0.0", version: "4.1.0", want: true},
+		{rng: ">=2.3.0", version: "2.3.0-beta.1", want: false},
+		{rng: "2.3.0-beta.1", version: "2.3.0-beta.1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rng+" "+tt.version, func(t *testing.T) {
+			r, err := ParseRange(tt.rng)
+			if err != nil {
+				t.Fatalf("ParseRange(%q) error = %v", tt.rng, err)
+			}
+			if got := r.Contains(MustParse(tt.version)); got != tt.want {
+				t.Errorf("ParseRange(%q).Contains(%q) = %v, want %v", tt.rng, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntervalCompare(t *testing.T) {
+	tests := []struct {
+		narrower string
+		wider    string
+		version  string
+	}{
+		{narrower: "2.3.0", wider: "2.3.x", version: "2.3.0"},
+		{narrower: "2.3.x", wider: "^2.3.0", version: "2.3.0"},
+		{narrower: "2.3", wider: "2.x", version: "2.3.0"},
+		{narrower: "^2.3.0", wider: "2.x", version: "2.3.0"},
+		{narrower: "^2.3.0", wider: ">=2.0.0 <3.0.0", version: "2.3.0"},
+		{narrower: "2.x", wider: ">=2.0.0", version: "2.3.0"},
+		{narrower: ">=2.3.0", wider: ">=2.0.0", version: "2.3.0"},
+		{narrower: "<2.4.0", wider: "<3.0.0", version: "2.3.0"},
+		{narrower: ">=2.0.0", wider: "*", version: "2.3.0"},
+		{narrower: "^0.2.3", wider: "0.2.x", version: "0.2.3"},
+		{narrower: "2.3.0 || >=4.0.0", wider: "2.x", version: "2.3.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.narrower+" < "+tt.wider, func(t *testing.T) {
+			narrower := mustMatch(t, tt.narrower, tt.version)
+			wider := mustMatch(t, tt.wider, tt.version)
+			if c := narrower.Compare(wider); c != -1 {
+				t.Errorf("Compare(%q, %q) = %d, want -1", tt.narrower, tt.wider, c)
+			}
+			if c := wider.Compare(narrower); c != 1 {
+				t.Errorf("Compare(%q, %q) = %d, want 1", tt.wider, tt.narrower, c)
+			}
+		})
+	}
+
+	equal := [][2]string{
+		{"2.x", ">=2.0.0 <3.0.0"},
+		{"2", "2.x"},
+		{"~2.3.0", "2.3.x"},
+		{">=2.0.0", "<3.0.0"},
+	}
+	for _, tt := range equal {
+		a, b := mustMatch(t, tt[0], "2.3.0"), mustMatch(t, tt[1], "2.3.0")
+		if c := a.Compare(b); c != 0 {
+			t.Errorf("Compare(%q, %q) = %d, want 0", tt[0], tt[1], c)
+		}
+	}
+}
+
+func mustMatch(t *testing.T, rng string, version string) Interval {
+	t.Helper()
+	r, err := ParseRange(rng)
+	if err != nil {
+		t.Fatalf("ParseRange(%q) error = %v", rng, err)
+	}
+	i, ok := r.Match(MustParse(version))
+	if !ok {
+		t.Fatalf("ParseRange(%q).Match(%q) didn't match", rng, version)
+	}
+	return i
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const apiTokenPrefix = "cgo_"
+
+type ApiTokenService struct {
+}
+
+// CreateToken generates a new token and stores its hash. The returned plain token is not stored anywhere,
+// so it can only be shown to the user once.
+func (svc *ApiTokenService) CreateToken(ctx context.Context, token db.ApiToken) (db.ApiToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return db.ApiToken{}, "", fmt.Errorf("generate token: %w", err)
+	}
+	plain := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	token.ID = primitive.NewObjectID()
+	token.TokenHash = HashApiToken(plain)
+	token.Prefix = plain[:len(apiTokenPrefix)+6]
+	token.CreatedAt = time.Now()
+	if token.AppIDs == nil {
+		token.AppIDs = []string{}
+	}
+
+	if _, err := db.Collections().ApiTokens().InsertOne(ctx, token); err != nil {
+		return db.ApiToken{}, "", err
+	}
+	return token, plain, nil
+}
+
+// Authenticate finds the token by its hash. Unknown and expired tokens are rejected with ErrApiTokenInvalid.
+func (svc *ApiTokenService) Authenticate(ctx context.Context, plain string) (db.ApiToken, error) {
+	var token db.ApiToken
+	err := db.Collections().ApiTokens().FindOne(ctx, bson.M{"token_hash": HashApiToken(plain)}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return db.ApiToken{}, ErrApiTokenInvalid
+		}
+		return db.ApiToken{}, err
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return db.ApiToken{}, ErrApiTokenInvalid
+	}
+	return token, nil
+}
+
+func HashApiToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AppService struct {
+}
+
+// FindApp finds a registered app by its app id.
+func (svc *AppService) FindApp(ctx context.Context, appID string) (db.App, error) {
+	var app db.App
+	err := db.Collections().Apps().FindOne(ctx, bson.M{"app_id": appID}).Decode(&app)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return db.App{}, ErrAppNotFound
+		}
+		return db.App{}, err
+	}
+	return app, nil
+}
+
+// RequireApp finds a registered app and checks that the platform is allowed. An empty platform is not checked.
+func (svc *AppService) RequireApp(ctx context.Context, appID string, platform db.Platform) (db.App, error) {
+	app, err := svc.FindApp(ctx, appID)
+	if err != nil {
+		return db.App{}, err
+	}
+	if platform != "" && !app.AllowsPlatform(platform) {
+		return db.App{}, ErrAppPlatformNotAllowed
+	}
+	return app, nil
+}
+
+// BundleSigner returns a signer of the app signing key, the server-wide signer, or nil if neither is configured.
+// App keys must be PEM encoded, a stored value of any other form is rejected with ErrAppKeyInvalid.
+func (svc *AppService) BundleSigner(app db.App) (*BundleSigner, error) {
+	if app.SigningPrivateKey != "" {
+		signer, err := NewBundleSignerFromPEM(app.SigningPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAppKeyInvalid, err)
+		}
+		return signer, nil
+	}
+	return DefaultBundleSigner()
+}
+
+// BundleEncryptor returns an encryptor of the app encryption key, the server-wide encryptor, or nil if neither is configured.
+// App keys must be PEM encoded, a stored value of any other form is rejected with ErrAppKeyInvalid.
+func (svc *AppService) BundleEncryptor(app db.App) (*BundleEncryptor, error) {
+	if app.EncryptionPrivateKey != "" {
+		encryptor, err := NewBundleEncryptorFromPEM(app.EncryptionPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAppKeyInvalid, err)
+		}
+		return encryptor, nil
+	}
+	return DefaultBundleEncryptor()
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const AuditActorKindSystem = "system"
+
+type AuditService struct {
+	appService AppService
+}
+
+// Record saves the audit event. The organization of the event is taken from its app if not set.
+func (svc *AuditService) Record(ctx context.Context, event db.AuditEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+	if event.Targets == nil {
+		event.Targets = []db.AuditTarget{}
+	}
+	if event.OrgID == nil && event.AppID != "" {
+		app, err := svc.appService.FindApp(ctx, event.AppID)
+		if err == nil {
+			event.OrgID = app.OrgID
+		}
+	}
+
+	_, err := db.Collections().AuditEvents().InsertOne(ctx, event)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	return nil
+}
+
+// AuditSnapshot encodes a document for Before or After of an audit event. It must be called before the document is
+// modified, as snapshots of nested pointers are otherwise changed as well.
+func AuditSnapshot(v interface{}) bson.Raw {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		slog.Error("Failed to encode audit snapshot", "error", err)
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StartAutoRollbackWatcher periodically evaluates the failure rate of the active bundle (or the bundle being rolled out)
+// of every release with an enabled auto rollback policy. Calling the returned stop function waits for the watcher to exit.
+func StartAutoRollbackWatcher() (stop func()) {
+	interval := config.Get().AutoRollbackInterval
+	if interval <= 0 {
+		slog.Info("Auto rollback watcher is disabled")
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := checkAutoRollback(ctx); err != nil {
+					slog.Error("Failed to check auto rollback", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func checkAutoRollback(ctx context.Context) error {
+	cursor, err := db.Collections().Releases().Find(ctx, bson.M{"auto_rollback.enabled": true})
+	if err != nil {
+		return fmt.Errorf("fetch releases: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var releases []db.Release
+	if err := cursor.All(ctx, &releases); err != nil {
+		return fmt.Errorf("decode releases: %w", err)
+	}
+
+	for _, release := range releases {
+		if err := evaluateAutoRollback(ctx, release); err != nil {
+			slog.Error("Failed to evaluate auto rollback", "error", err, "release", release.ID.Hex())
+		}
+	}
+	return nil
+}
+
+func evaluateAutoRollback(ctx context.Context, release db.Release) error {
+	policy := release.AutoRollback
+
+	var bundleID primitive.ObjectID
+	var since time.Time
+	// A paused rollout still serves its bundle to devices within the percentage, the same as in selectBundleID.
+	rollingOut := release.Rollout.IsRunning()
+	switch {
+	case rollingOut:
+		bundleID = release.Rollout.BundleID
+		since = release.Rollout.StartedAt
+	case release.ActiveBundleID != nil && !release.ActiveBundleID.IsZero() && *release.ActiveBundleID != release.BuiltinBundleID:
+		bundleID = *release.ActiveBundleID
+		since = release.UpdatedAt
+		if release.ActiveBundleSetAt != nil {
+			since = *release.ActiveBundleSetAt
+		}
+	default:
+		return nil
+	}
+
+	var bundle db.Bundle
+	if err := db.Collections().Bundles().FindOne(ctx, bson.M{"_id": bundleID}).Decode(&bundle); err != nil {
+		return fmt.Errorf("find bundle %s: %w", bundleID.Hex(), err)
+	}
+
+	filter := StatsFilter{
+		AppID:        release.AppID,
+		VersionNames: []string{bundle.VersionName},
+		Platform:     release.Platform,
+		VersionBuild: release.VersionName,
+		VersionCode:  release.VersionCode,
+		Since:        since,
+	}
+	if release.Targeting != nil {
+		// Devices of a targeting release run various native builds, so events of every build are counted.
+		filter.VersionBuild = ""
+		filter.VersionCode = ""
+	}
+	stats, err := (&StatsService{}).CountByVersionName(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("count stats: %w", err)
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+
+	total := stats[0].Sets + stats[0].Failures
+	if total == 0 || total < policy.MinEvents {
+		return nil
+	}
+	rate := float64(stats[0].Failures) / float64(total)
+	if rate <= policy.FailureRateThreshold {
+		return nil
+	}
+
+	var target *primitive.ObjectID
+	now := time.Now()
+	extraSet := bson.M{
+		"previous_active_bundle_id": nil,
+	}
+	if rollingOut {
+		target = &release.Rollout.FallbackBundleID
+		extraSet["rollout.status"] = db.RolloutStatusAborted
+		extraSet["rollout.updated_at"] = now
+	} else if release.PreviousActiveBundleID != nil && !release.PreviousActiveBundleID.IsZero() && *release.PreviousActiveBundleID != bundleID {
+		target = release.PreviousActiveBundleID
+	}
+
+	record := db.RollbackRecord{
+		FromBundleID: bundleID,
+		ToBundleID:   target,
+		FailureRate:  rate,
+		Failures:     stats[0].Failures,
+		Sets:         stats[0].Sets,
+		Reason: fmt.Sprintf("failure rate %.2f exceeded threshold %.2f (%d failures of %d events since %s)",
+			rate, policy.FailureRateThreshold, stats[0].Failures, total, since.Format(time.RFC3339)),
+		At: now,
+	}
+	extraSet["last_rollback"] = record
+
+	updated, err := (&ReleaseService{}).SetActiveBundle(ctx, release, target, extraSet)
+	if err != nil {
+		return fmt.Errorf("roll back release: %w", err)
+	}
+
+	err = (&AuditService{}).Record(ctx, db.AuditEvent{
+		Action:  "releases.auto-rollback",
+		Actor:   db.AuditActor{Kind: AuditActorKindSystem, Subject: "auto-rollback"},
+		AppID:   release.AppID,
+		Targets: []db.AuditTarget{{Type: db.AuditTargetRelease, ID: release.ID.Hex()}, {Type: db.AuditTargetBundle, ID: bundleID.Hex()}},
+		Before:  AuditSnapshot(release),
+		After:   AuditSnapshot(updated),
+	})
+	if err != nil {
+		slog.Error("Failed to record audit event of automatic rollback", "error", err, "release", release.ID.Hex())
+	}
+
+	data := NewWebhookReleaseData(updated)
+	data.Reason = record.Reason
+	(&WebhookService{}).Dispatch(ctx, release.AppID, db.WebhookEventAutoRollbackTriggered, data)
+
+	toBundle := "builtin"
+	if target != nil {
+		toBundle = target.Hex()
+	}
+	slog.Warn("Release is rolled back automatically",
+		"release", release.ID.Hex(),
+		"from_bundle", bundleID.Hex(),
+		"to_bundle", toBundle,
+		"reason", record.Reason,
+	)
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BundleBackfillReport is the result of backfilling integrity metadata of existing bundles.
+type BundleBackfillReport struct {
+	DryRun  bool                   `json:"dry_run"`
+	Updated []BundleBackfillResult `json:"updated"`
+	Failed  []BundleBackfillResult `json:"failed"`
+}
+
+type BundleBackfillResult struct {
+	BundleID       string `json:"bundle_id"`
+	AppID          string `json:"app_id"`
+	VersionName    string `json:"version_name"`
+	SHA256Checksum string `json:"sha256_checksum,omitempty"`
+	Size           int64  `json:"size,omitempty"`
+	ContentType    string `json:"content_type,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// BackfillBundleIntegrity computes SHA-256, size and MIME type of bundles uploaded before they were recorded, by reading
+// their stored objects. The original zip of an encrypted bundle isn't stored, so only its size and MIME type are backfilled.
+// Bundles uploaded before the bundle storage only have a public download url, so their object key is derived from it.
+func BackfillBundleIntegrity(ctx context.Context, dryRun bool) (BundleBackfillReport, error) {
+	report := BundleBackfillReport{
+		DryRun:  dryRun,
+		Updated: []BundleBackfillResult{},
+		Failed:  []BundleBackfillResult{},
+	}
+
+	cursor, err := db.Collections().Bundles().Find(ctx, bson.M{
+		"$or": []bson.M{
+			{"size": nil},
+			{"content_type": nil},
+			{"encryption": nil, "sha256_checksum": nil},
+		},
+	})
+	if err != nil {
+		return report, fmt.Errorf("fetch bundles: %w", err)
+	}
+	var bundles []db.Bundle
+	if err := cursor.All(ctx, &bundles); err != nil {
+		return report, fmt.Errorf("decode bundles: %w", err)
+	}
+
+	updated := false
+	for _, bundle := range bundles {
+		result := BundleBackfillResult{
+			BundleID:    bundle.ID.Hex(),
+			AppID:       bundle.AppID,
+			VersionName: bundle.VersionName,
+		}
+
+		set, err := computeBundleIntegrity(ctx, bundle, &result)
+		if err == nil && !dryRun {
+			_, err = db.Collections().Bundles().UpdateOne(ctx, bson.M{"_id": bundle.ID}, bson.M{"$set": set})
+			updated = true
+		}
+		if err != nil {
+			result.Error = err.Error()
+			report.Failed = append(report.Failed, result)
+			continue
+		}
+		report.Updated = append(report.Updated, result)
+	}
+
+	if updated {
+		InvalidateLatestCache(ctx)
+	}
+	return report, nil
+}
+
+func computeBundleIntegrity(ctx context.Context, bundle db.Bundle, result *BundleBackfillResult) (bson.M, error) {
+	if bundle.StorageKey == "" {
+		key, ok := legacyBundleStorageKey(bundle.PublicDownloadURL)
+		if !ok {
+			return nil, fmt.Errorf("%w: bundle has neither a storage key nor a public download url of the bundle storage", ErrBundleNotFound)
+		}
+		// Only used for reading the object, the bundle is still downloaded from its public download url.
+		bundle.StorageKey = key
+	}
+
+	r, size, err := (&BundleService{}).OpenBundle(ctx, bundle)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	content := io.TeeReader(r, hash)
+
+	contentType := BundleContentTypeEncrypted
+	if bundle.Encryption == nil {
+		contentType, err = DetectBundleContentType(content)
+		if err != nil {
+			return nil, fmt.Errorf("detect content type: %w", err)
+		}
+	}
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return nil, fmt.Errorf("read bundle object: %w", err)
+	}
+
+	result.Size = size
+	result.ContentType = contentType
+	set := bson.M{
+		"size":         size,
+		"content_type": contentType,
+	}
+	if bundle.Encryption == nil {
+		sum := hex.EncodeToString(hash.Sum(nil))
+		result.SHA256Checksum = sum
+		set["sha256_checksum"] = sum
+		// The stored object of an unencrypted bundle is the uploaded file, so identical uploads are deduplicated to it as well.
+		if bundle.SHA256 == "" {
+			set["sha256"] = sum
+		}
+	}
+	return set, nil
+}
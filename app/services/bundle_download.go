@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	BundleDownloadURLModePresigned = "presigned"
+	BundleDownloadURLModeSigned    = "signed"
+	BundleDownloadURLModePublic    = "public"
+)
+
+// CreateBundleDownloadURL creates a download url of the bundle for a device, according to the configured download url mode.
+// Bundles uploaded before private storage was introduced have no storage key, so their public url is returned as-is.
+// If the storage backend can't provide a download url itself, e.g. local storage, a signed url to capgo-server is returned.
+func (svc *UpdateService) CreateBundleDownloadURL(ctx context.Context, bundle db.Bundle) (*url.URL, error) {
+	mode := config.Get().BundleDownloadURLMode
+	if bundle.StorageKey == "" || (mode == BundleDownloadURLModePublic && bundle.PublicDownloadURL != "") {
+		return url.Parse(bundle.PublicDownloadURL)
+	}
+
+	ttl := config.Get().BundleDownloadURLTTL
+	switch mode {
+	case BundleDownloadURLModePresigned, BundleDownloadURLModePublic:
+		st, err := storage.Default()
+		if err != nil {
+			return nil, err
+		}
+		rawURL, err := st.DownloadURL(ctx, bundle.StorageKey, ttl)
+		if errors.Is(err, storage.ErrDownloadURLNotSupported) {
+			return createSignedBundleDownloadURL(bundle.ID, time.Now().Add(ttl))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("create bundle url: %w", err)
+		}
+		return url.Parse(rawURL)
+	case BundleDownloadURLModeSigned:
+		return createSignedBundleDownloadURL(bundle.ID, time.Now().Add(ttl))
+	default:
+		return nil, ErrBundleDownloadURLModeInvalid
+	}
+}
+
+// OpenSignedBundle verifies a signed bundle download url and opens the bundle zip file. The caller must close the reader.
+func (svc *UpdateService) OpenSignedBundle(ctx context.Context, bundleID primitive.ObjectID, expires string, signature string) (io.ReadCloser, int64, error) {
+	if err := verifyBundleDownloadSignature(bundleID, expires, signature); err != nil {
+		return nil, 0, err
+	}
+
+	var bundle db.Bundle
+	// A deleted bundle is not downloadable anymore, even with a url signed before it was deleted.
+	err := db.Collections().Bundles().FindOne(ctx, bson.M{"_id": bundleID, "deleted_at": nil}).Decode(&bundle)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, 0, ErrBundleNotFound
+		}
+		return nil, 0, err
+	}
+	return (&BundleService{}).OpenBundle(ctx, bundle)
+}
+
+func createSignedBundleDownloadURL(bundleID primitive.ObjectID, expiresAt time.Time) (*url.URL, error) {
+	secret := config.Get().BundleDownloadURLSecret
+	baseURL := config.Get().PublicBaseURL
+	if secret == "" || baseURL == "" {
+		return nil, fmt.Errorf("%w: signed mode requires bundle download url secret and public base url", ErrBundleDownloadURLModeInvalid)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/bundles/" + bundleID.Hex() + "/download")
+	if err != nil {
+		return nil, fmt.Errorf("invalid public base url: %w", err)
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	q := u.Query()
+	q.Set("expires", expires)
+	q.Set("signature", signBundleDownload(secret, bundleID, expires))
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+func verifyBundleDownloadSignature(bundleID primitive.ObjectID, expires string, signature string) error {
+	secret := config.Get().BundleDownloadURLSecret
+	if secret == "" {
+		return ErrBundleDownloadURLInvalid
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrBundleDownloadURLInvalid
+	}
+
+	expected := signBundleDownload(secret, bundleID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBundleDownloadURLInvalid
+	}
+	return nil
+}
+
+func signBundleDownload(secret string, bundleID primitive.ObjectID, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(bundleID.Hex() + "|" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
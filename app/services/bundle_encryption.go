@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+)
+
+var (
+	bundleEncryptorOnce sync.Once
+	bundleEncryptor     *BundleEncryptor
+	bundleEncryptorErr  error
+)
+
+// BundleEncryptor encrypts bundle zip files in the format decrypted by Capgo plugin: AES-128-CBC with a random key and IV,
+// where the AES key is encrypted with the RSA private key (PKCS#1 v1.5). The app decrypts it with the matching public key.
+type BundleEncryptor struct {
+	key         *rsa.PrivateKey
+	fingerprint string
+}
+
+// DefaultBundleEncryptor returns an encryptor of the configured encryption key, or nil if bundle encryption is not configured.
+func DefaultBundleEncryptor() (*BundleEncryptor, error) {
+	bundleEncryptorOnce.Do(func() {
+		value := config.Get().BundleEncryptionPrivateKey
+		if value == "" {
+			return
+		}
+		bundleEncryptor, bundleEncryptorErr = NewBundleEncryptor(value)
+	})
+	return bundleEncryptor, bundleEncryptorErr
+}
+
+// NewBundleEncryptor creates an encryptor from a PEM encoded RSA private key or a path to it.
+func NewBundleEncryptor(privateKey string) (*BundleEncryptor, error) {
+	key, err := loadPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("load bundle encryption key: %w", err)
+	}
+	return newBundleEncryptor(key)
+}
+
+// NewBundleEncryptorFromPEM creates an encryptor from a PEM encoded RSA private key. Unlike NewBundleEncryptor, the key
+// can't be a path, so it's used for keys provided via the API.
+func NewBundleEncryptorFromPEM(privateKey string) (*BundleEncryptor, error) {
+	key, err := parsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse bundle encryption key: %w", err)
+	}
+	return newBundleEncryptor(key)
+}
+
+func newBundleEncryptor(key crypto.Signer) (*BundleEncryptor, error) {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("bundle encryption key must be an RSA key, got %T", key)
+	}
+	fingerprint, err := publicKeyFingerprint(rsaKey)
+	if err != nil {
+		return nil, fmt.Errorf("bundle encryption key: %w", err)
+	}
+	return &BundleEncryptor{key: rsaKey, fingerprint: fingerprint}, nil
+}
+
+// Fingerprint identifies the encryption key, so bundles encrypted with another key can be told apart.
+func (e *BundleEncryptor) Fingerprint() string {
+	return e.fingerprint
+}
+
+// Encrypt encrypts the bundle zip file and returns the encrypted data with its IV and wrapped AES key.
+func (e *BundleEncryptor) Encrypt(r io.Reader) ([]byte, db.BundleEncryption, error) {
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, db.BundleEncryption{}, err
+	}
+
+	aesKey := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, db.BundleEncryption{}, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, db.BundleEncryption{}, err
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, db.BundleEncryption{}, err
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	// Signing without a hash is a raw PKCS#1 v1.5 private key encryption, which is what the app reverses with the public key.
+	wrappedKey, err := rsa.SignPKCS1v15(nil, e.key, crypto.Hash(0), aesKey)
+	if err != nil {
+		return nil, db.BundleEncryption{}, fmt.Errorf("wrap session key: %w", err)
+	}
+
+	return data, db.BundleEncryption{
+		IV:         base64.StdEncoding.EncodeToString(iv),
+		WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+	}, nil
+}
+
+// ParseSessionKey parses a session key produced by Capgo CLI for a bundle it already encrypted, in the `<IV>:<key>` format.
+func ParseSessionKey(sessionKey string) (db.BundleEncryption, error) {
+	iv, key, ok := strings.Cut(sessionKey, ":")
+	if !ok || iv == "" || key == "" {
+		return db.BundleEncryption{}, errors.New("session key must be in <base64 IV>:<base64 key> format")
+	}
+	if b, err := base64.StdEncoding.DecodeString(iv); err != nil || len(b) != aes.BlockSize {
+		return db.BundleEncryption{}, errors.New("session key has an invalid IV")
+	}
+	if _, err := base64.StdEncoding.DecodeString(key); err != nil {
+		return db.BundleEncryption{}, errors.New("session key has an invalid key")
+	}
+	return db.BundleEncryption{
+		IV:         iv,
+		WrappedKey: key,
+	}, nil
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BundleGCOptions struct {
+	// DryRun only reports what would be cleaned up.
+	DryRun bool
+	// OrphanGrace is how old a stored object without a bundle must be before it's deleted.
+	OrphanGrace time.Duration
+	// SweepBucket deletes every stored object without a bundle, not only objects of the bundle key layout.
+	// The bucket must not be shared with other data.
+	SweepBucket bool
+}
+
+// BundleGCReport is the result of a garbage collection run.
+type BundleGCReport struct {
+	DryRun bool `json:"dry_run"`
+	// Expired are bundles deleted by the retention policy of their app. They are purged after BUNDLE_DELETE_RETENTION.
+	Expired []BundleGCBundle `json:"expired"`
+	// OrphanedObjects are stored objects without a bundle. They are deleted right away.
+	OrphanedObjects []BundleGCObject `json:"orphaned_objects"`
+	// MissingObjects are bundles whose stored object doesn't exist. They are only reported.
+	MissingObjects []BundleGCBundle `json:"missing_objects"`
+	Errors         []string         `json:"errors"`
+}
+
+type BundleGCBundle struct {
+	BundleID    string    `json:"bundle_id"`
+	AppID       string    `json:"app_id"`
+	VersionName string    `json:"version_name"`
+	StorageKey  string    `json:"storage_key"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type BundleGCObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+func newBundleGCBundle(bundle db.Bundle) BundleGCBundle {
+	return BundleGCBundle{
+		BundleID:    bundle.ID.Hex(),
+		AppID:       bundle.AppID,
+		VersionName: bundle.VersionName,
+		StorageKey:  bundle.StorageKey,
+		CreatedAt:   bundle.CreatedAt,
+	}
+}
+
+// StartBundleGC periodically runs RunBundleGC. Calling the returned stop function waits for the job to exit.
+func StartBundleGC() (stop func()) {
+	interval := config.Get().BundleGCInterval
+	if interval <= 0 {
+		slog.Info("Bundle garbage collection job is disabled")
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report, err := RunBundleGC(ctx, BundleGCOptions{
+					OrphanGrace: config.Get().BundleGCOrphanGrace,
+					SweepBucket: config.Get().BundleGCSweepBucket,
+				})
+				if err != nil {
+					slog.Error("Failed to run bundle garbage collection", "error", err)
+					continue
+				}
+				slog.Info("Bundle garbage collection done",
+					"expired", len(report.Expired),
+					"orphaned_objects", len(report.OrphanedObjects),
+					"missing_objects", len(report.MissingObjects),
+					"errors", len(report.Errors))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// RunBundleGC applies the retention policy of every app, deletes stored objects without a bundle and finds bundles
+// whose stored object is missing. Failures of a single bundle or object are collected in the report instead of
+// stopping the run.
+func RunBundleGC(ctx context.Context, opts BundleGCOptions) (BundleGCReport, error) {
+	report := BundleGCReport{
+		DryRun:          opts.DryRun,
+		Expired:         []BundleGCBundle{},
+		OrphanedObjects: []BundleGCObject{},
+		MissingObjects:  []BundleGCBundle{},
+		Errors:          []string{},
+	}
+
+	if err := applyRetentionPolicies(ctx, opts, &report); err != nil {
+		return report, err
+	}
+	if err := collectStorageGarbage(ctx, opts, &report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func applyRetentionPolicies(ctx context.Context, opts BundleGCOptions, report *BundleGCReport) error {
+	cursor, err := db.Collections().Apps().Find(ctx, bson.M{"retention": bson.M{"$ne": nil}})
+	if err != nil {
+		return fmt.Errorf("fetch apps: %w", err)
+	}
+	var apps []db.App
+	if err := cursor.All(ctx, &apps); err != nil {
+		return fmt.Errorf("decode apps: %w", err)
+	}
+
+	for _, app := range apps {
+		if err := applyRetentionPolicy(ctx, app, opts, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("app %s: %v", app.AppID, err))
+		}
+	}
+	return nil
+}
+
+// applyRetentionPolicy deletes bundles of the app that match no condition of its retention policy. A policy without
+// any condition keeps every bundle.
+func applyRetentionPolicy(ctx context.Context, app db.App, opts BundleGCOptions, report *BundleGCReport) error {
+	policy := app.Retention
+	if policy == nil || (policy.KeepLast <= 0 && policy.KeepDays <= 0) {
+		return nil
+	}
+
+	cursor, err := db.Collections().Bundles().Find(
+		ctx,
+		bson.M{"app_id": app.AppID, "deleted_at": nil},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return fmt.Errorf("fetch bundles: %w", err)
+	}
+	var bundles []db.Bundle
+	if err := cursor.All(ctx, &bundles); err != nil {
+		return fmt.Errorf("decode bundles: %w", err)
+	}
+
+	keepAfter := time.Now().AddDate(0, 0, -policy.KeepDays)
+	bundleService := &BundleService{}
+	for i, bundle := range bundles {
+		if policy.KeepLast > 0 && i < policy.KeepLast {
+			continue
+		}
+		if policy.KeepDays > 0 && bundle.CreatedAt.After(keepAfter) {
+			continue
+		}
+
+		refs, err := bundleService.FindReferences(ctx, bundle.ID)
+		if err != nil {
+			return err
+		}
+		if !refs.IsEmpty() {
+			continue
+		}
+
+		if !opts.DryRun {
+			deleted, _, err := bundleService.Delete(ctx, bundle, false)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete bundle %s: %v", bundle.ID.Hex(), err))
+				continue
+			}
+			err = (&AuditService{}).Record(ctx, db.AuditEvent{
+				Action:  "bundles.delete",
+				Actor:   db.AuditActor{Kind: AuditActorKindSystem, Subject: "bundle-gc"},
+				AppID:   bundle.AppID,
+				Targets: []db.AuditTarget{{Type: db.AuditTargetBundle, ID: bundle.ID.Hex()}},
+				Before:  AuditSnapshot(bundle),
+				After:   AuditSnapshot(deleted),
+			})
+			if err != nil {
+				slog.Error("Failed to record audit event of bundle retention", "error", err, "bundle", bundle.ID.Hex())
+			}
+		}
+		report.Expired = append(report.Expired, newBundleGCBundle(bundle))
+	}
+	return nil
+}
+
+// collectStorageGarbage compares stored objects with bundles. Deleted bundles still own their objects until they're purged.
+// The bucket may be shared with other data, so unless opts.SweepBucket, only objects of the bundle key layout are listed
+// and deleted, i.e. <app_id>/<sha256>.zip of known apps and <yyyy-mm>/<file>.zip of uploads before the bundle storage.
+func collectStorageGarbage(ctx context.Context, opts BundleGCOptions, report *BundleGCReport) error {
+	cursor, err := db.Collections().Bundles().Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("fetch bundles: %w", err)
+	}
+	var bundles []db.Bundle
+	if err := cursor.All(ctx, &bundles); err != nil {
+		return fmt.Errorf("decode bundles: %w", err)
+	}
+
+	bundleKeys := make(map[string]struct{}, len(bundles))
+	appIDs := map[string]struct{}{}
+	firstCreatedAt := time.Now()
+	for _, bundle := range bundles {
+		appIDs[bundle.AppID] = struct{}{}
+		if bundle.CreatedAt.Before(firstCreatedAt) {
+			firstCreatedAt = bundle.CreatedAt
+		}
+		// Bundles uploaded before the bundle storage only have a public download url, which contains their object key.
+		if bundle.StorageKey != "" {
+			bundleKeys[bundle.StorageKey] = struct{}{}
+		} else if key, ok := legacyBundleStorageKey(bundle.PublicDownloadURL); ok {
+			bundleKeys[key] = struct{}{}
+		}
+	}
+
+	prefixes := []string{""}
+	if !opts.SweepBucket {
+		prefixes, err = bundleObjectPrefixes(ctx, appIDs, firstCreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	isListed := func(key string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	isBundleObject := func(key string) bool {
+		return opts.SweepBucket || contentBundleKeyPattern.MatchString(key) || legacyBundleKeyPattern.MatchString(key)
+	}
+
+	st, err := storage.Default()
+	if err != nil {
+		return err
+	}
+
+	objectKeys := map[string]struct{}{}
+	orphanedBefore := time.Now().Add(-opts.OrphanGrace)
+	for _, prefix := range prefixes {
+		err = st.List(ctx, prefix, func(obj storage.ObjectInfo) error {
+			objectKeys[obj.Key] = struct{}{}
+			if _, ok := bundleKeys[obj.Key]; ok || !isBundleObject(obj.Key) || obj.LastModified.After(orphanedBefore) {
+				return nil
+			}
+
+			if !opts.DryRun {
+				if err := st.Delete(ctx, obj.Key); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+					report.Errors = append(report.Errors, fmt.Sprintf("delete object %s: %v", obj.Key, err))
+					return nil
+				}
+			}
+			report.OrphanedObjects = append(report.OrphanedObjects, BundleGCObject{
+				Key:          obj.Key,
+				Size:         obj.Size,
+				LastModified: obj.LastModified,
+			})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("list objects of %q: %w", prefix, err)
+		}
+	}
+
+	for _, bundle := range bundles {
+		if bundle.StorageKey == "" || !isListed(bundle.StorageKey) {
+			continue
+		}
+		if _, ok := objectKeys[bundle.StorageKey]; !ok {
+			report.MissingObjects = append(report.MissingObjects, newBundleGCBundle(bundle))
+		}
+	}
+	return nil
+}
+
+// bundleObjectPrefixes returns the key prefixes of bundle objects: one per app, and one per month since the first bundle
+// for uploads before the bundle storage.
+func bundleObjectPrefixes(ctx context.Context, appIDs map[string]struct{}, since time.Time) ([]string, error) {
+	cursor, err := db.Collections().Apps().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("fetch apps: %w", err)
+	}
+	var apps []db.App
+	if err := cursor.All(ctx, &apps); err != nil {
+		return nil, fmt.Errorf("decode apps: %w", err)
+	}
+	for _, app := range apps {
+		appIDs[app.AppID] = struct{}{}
+	}
+
+	var prefixes []string
+	for appID := range appIDs {
+		if appID != "" {
+			prefixes = append(prefixes, appID+"/")
+		}
+	}
+	slices.Sort(prefixes)
+
+	// Legacy keys were formatted in local time, so the month before the first bundle is included as well.
+	month := time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	for ; !month.After(time.Now()); month = month.AddDate(0, 1, 0) {
+		prefixes = append(prefixes, month.Format("2006-01")+"/")
+	}
+	return prefixes, nil
+}
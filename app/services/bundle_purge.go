@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StartBundlePurger periodically purges bundles deleted longer than BundleDeleteRetention ago, removing both the stored
+// object and the bundle. Calling the returned stop function waits for the purger to exit.
+func StartBundlePurger() (stop func()) {
+	interval := config.Get().BundlePurgeInterval
+	if interval <= 0 {
+		slog.Info("Bundle purger is disabled")
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := purgeDeletedBundles(ctx, time.Now().Add(-config.Get().BundleDeleteRetention)); err != nil {
+					slog.Error("Failed to purge deleted bundles", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// purgeDeletedBundles purges bundles deleted before the given time.
+func purgeDeletedBundles(ctx context.Context, deletedBefore time.Time) error {
+	cursor, err := db.Collections().Bundles().Find(ctx, bson.M{"deleted_at": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return fmt.Errorf("fetch deleted bundles: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var bundles []db.Bundle
+	if err := cursor.All(ctx, &bundles); err != nil {
+		return fmt.Errorf("decode deleted bundles: %w", err)
+	}
+
+	for _, bundle := range bundles {
+		if err := purgeBundle(ctx, bundle); err != nil {
+			slog.Error("Failed to purge deleted bundle", "error", err, "bundle", bundle.ID.Hex())
+		}
+	}
+	return nil
+}
+
+func purgeBundle(ctx context.Context, bundle db.Bundle) error {
+	// A release may have been pointed to the bundle while it was being deleted, so it's kept until detached again.
+	refs, err := (&BundleService{}).FindReferences(ctx, bundle.ID)
+	if err != nil {
+		return err
+	}
+	if !refs.IsEmpty() {
+		slog.Warn("Deleted bundle is still in use, skip purging", "bundle", bundle.ID.Hex())
+		return nil
+	}
+
+	// Identical bundles share their stored object, so it's only deleted with the last bundle using it.
+	shared := int64(0)
+	if bundle.StorageKey != "" {
+		shared, err = db.Collections().Bundles().CountDocuments(ctx, bson.M{"storage_key": bundle.StorageKey, "_id": bson.M{"$ne": bundle.ID}})
+		if err != nil {
+			return fmt.Errorf("count bundles sharing the object: %w", err)
+		}
+	}
+	if bundle.StorageKey != "" && shared == 0 {
+		st, err := storage.Default()
+		if err != nil {
+			return err
+		}
+		if err := st.Delete(ctx, bundle.StorageKey); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return fmt.Errorf("delete bundle object: %w", err)
+		}
+	}
+
+	_, err = db.Collections().Bundles().DeleteOne(ctx, bson.M{"_id": bundle.ID, "deleted_at": bson.M{"$ne": nil}})
+	if err != nil {
+		return fmt.Errorf("delete bundle: %w", err)
+	}
+
+	err = (&AuditService{}).Record(ctx, db.AuditEvent{
+		Action:  "bundles.purge",
+		Actor:   db.AuditActor{Kind: AuditActorKindSystem, Subject: "bundle-purger"},
+		AppID:   bundle.AppID,
+		Targets: []db.AuditTarget{{Type: db.AuditTargetBundle, ID: bundle.ID.Hex()}},
+		Before:  AuditSnapshot(bundle),
+	})
+	if err != nil {
+		slog.Error("Failed to record audit event of bundle purge", "error", err, "bundle", bundle.ID.Hex())
+	}
+	slog.Info("Purged deleted bundle", "bundle", bundle.ID.Hex(), "app_id", bundle.AppID)
+	return nil
+}
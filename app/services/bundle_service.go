@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BundleService struct {
+}
+
+// OpenBundle opens the bundle zip file from the bundle storage. The caller must close the reader.
+func (svc *BundleService) OpenBundle(ctx context.Context, bundle db.Bundle) (io.ReadCloser, int64, error) {
+	if bundle.StorageKey == "" {
+		return nil, 0, fmt.Errorf("%w: bundle %s has no storage key", ErrBundleNotFound, bundle.ID.Hex())
+	}
+
+	st, err := storage.Default()
+	if err != nil {
+		return nil, 0, err
+	}
+	r, info, err := st.Get(ctx, bundle.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, 0, fmt.Errorf("%w: %v", ErrBundleNotFound, err)
+		}
+		return nil, 0, fmt.Errorf("get bundle object: %w", err)
+	}
+	return r, info.Size, nil
+}
+
+var (
+	// contentBundleKeyPattern is the key layout of bundles stored by their content: <app_id>/<sha256>.zip.
+	contentBundleKeyPattern = regexp.MustCompile(`^[^/]+/[0-9a-f]{64}\.zip$`)
+	// legacyBundleKeyPattern is the key layout of uploads before the bundle storage: <yyyy-mm>/<version_name>_<xid>.zip.
+	legacyBundleKeyPattern = regexp.MustCompile(`^\d{4}-\d{2}/[^/]+\.zip$`)
+)
+
+// legacyBundleStorageKey derives the object key of a bundle uploaded before the bundle storage from its public download
+// url, e.g. 2024-05/1.0.0_cp1a2b3c.zip of https://bucket.s3.amazonaws.com/2024-05/1.0.0_cp1a2b3c.zip.
+func legacyBundleStorageKey(publicDownloadURL string) (string, bool) {
+	u, err := url.Parse(publicDownloadURL)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return "", false
+	}
+	key := strings.Join(parts[len(parts)-2:], "/")
+	if !legacyBundleKeyPattern.MatchString(key) {
+		return "", false
+	}
+	return key, true
+}
+
+// Resign signs the stored bundle zip file again with the given signer and saves the new signature, e.g. after key rotation.
+// Encrypted bundles can't be re-signed because the signature is of the original zip file.
+func (svc *BundleService) Resign(ctx context.Context, bundle db.Bundle, signer *BundleSigner) (string, error) {
+	if bundle.Encryption != nil {
+		return "", ErrBundleEncrypted
+	}
+
+	r, _, err := svc.OpenBundle(ctx, bundle)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	signature, err := signer.Sign(r)
+	if err != nil {
+		return "", fmt.Errorf("sign bundle: %w", err)
+	}
+
+	_, err = db.Collections().Bundles().UpdateOne(ctx, bson.M{"_id": bundle.ID}, bson.M{
+		"$set": bson.M{
+			"signature":               signature,
+			"signed_at":               time.Now(),
+			"signing_key_fingerprint": signer.Fingerprint(),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("save bundle signature: %w", err)
+	}
+
+	InvalidateLatestCache(ctx)
+	return signature, nil
+}
+
+// BundleReferences are releases and channels using a bundle.
+type BundleReferences struct {
+	// Builtin are releases using the bundle as their builtin bundle.
+	Builtin []db.Release
+	// Active are releases using the bundle as their active bundle.
+	Active []db.Release
+	// Rollout are releases with a running rollout of the bundle, or falling back to the bundle.
+	Rollout []db.Release
+	// Channels are channels pinning the bundle for a release.
+	Channels []db.Channel
+}
+
+func (refs BundleReferences) IsEmpty() bool {
+	return len(refs.Builtin) == 0 && len(refs.Active) == 0 && len(refs.Rollout) == 0 && len(refs.Channels) == 0
+}
+
+// FindReferences finds releases and channels using the bundle.
+func (svc *BundleService) FindReferences(ctx context.Context, bundleID primitive.ObjectID) (BundleReferences, error) {
+	var refs BundleReferences
+
+	cursor, err := db.Collections().Releases().Find(ctx, bson.M{"$or": []bson.M{
+		{"builtin_bundle_id": bundleID},
+		{"active_bundle_id": bundleID},
+		{"rollout.bundle_id": bundleID},
+		{"rollout.fallback_bundle_id": bundleID},
+	}})
+	if err != nil {
+		return refs, fmt.Errorf("fetch releases: %w", err)
+	}
+	var releases []db.Release
+	if err := cursor.All(ctx, &releases); err != nil {
+		return refs, fmt.Errorf("decode releases: %w", err)
+	}
+	for _, release := range releases {
+		if release.BuiltinBundleID == bundleID {
+			refs.Builtin = append(refs.Builtin, release)
+		}
+		if release.ActiveBundleID != nil && *release.ActiveBundleID == bundleID {
+			refs.Active = append(refs.Active, release)
+		}
+		if release.Rollout.IsRunning() && (release.Rollout.BundleID == bundleID || release.Rollout.FallbackBundleID == bundleID) {
+			refs.Rollout = append(refs.Rollout, release)
+		}
+	}
+
+	cursor, err = db.Collections().Channels().Find(ctx, bson.M{"bundles.bundle_id": bundleID})
+	if err != nil {
+		return refs, fmt.Errorf("fetch channels: %w", err)
+	}
+	if err := cursor.All(ctx, &refs.Channels); err != nil {
+		return refs, fmt.Errorf("decode channels: %w", err)
+	}
+	return refs, nil
+}
+
+// Delete marks the bundle as deleted. The bundle can be restored until it's purged after BundleDeleteRetention.
+// A bundle used as a builtin bundle or by a running rollout is never deleted. A bundle used as an active bundle or
+// pinned by a channel is only deleted with force, which reverts the releases to their builtin bundle and unpins
+// the bundle from the channels. The returned references are the ones detached from the bundle.
+func (svc *BundleService) Delete(ctx context.Context, bundle db.Bundle, force bool) (db.Bundle, BundleReferences, error) {
+	if bundle.DeletedAt != nil {
+		return bundle, BundleReferences{}, ErrBundleDeleted
+	}
+
+	refs, err := svc.FindReferences(ctx, bundle.ID)
+	if err != nil {
+		return bundle, refs, err
+	}
+	if len(refs.Builtin) > 0 {
+		return bundle, refs, ErrBundleIsBuiltin.WithDetails("release_id", refs.Builtin[0].ID.Hex())
+	}
+	if len(refs.Rollout) > 0 {
+		return bundle, refs, ErrBundleInRollout.WithDetails("release_id", refs.Rollout[0].ID.Hex())
+	}
+	if !refs.IsEmpty() && !force {
+		return bundle, refs, ErrBundleInUse.
+			WithDetails("releases", len(refs.Active)).
+			WithDetails("channels", len(refs.Channels))
+	}
+
+	// The bundle is marked first, so it can't be assigned again while being detached.
+	now := time.Now()
+	result, err := db.Collections().Bundles().UpdateOne(
+		ctx,
+		bson.M{"_id": bundle.ID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": now}},
+	)
+	if err != nil {
+		return bundle, refs, fmt.Errorf("mark bundle as deleted: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return bundle, refs, ErrBundleDeleted
+	}
+	bundle.DeletedAt = &now
+
+	releaseService := &ReleaseService{}
+	for _, release := range refs.Active {
+		if _, err := releaseService.SetActiveBundle(ctx, release, nil, nil); err != nil {
+			return bundle, refs, fmt.Errorf("revert release %s to builtin bundle: %w", release.ID.Hex(), err)
+		}
+	}
+	for _, channel := range refs.Channels {
+		_, err := db.Collections().Channels().UpdateOne(
+			ctx,
+			bson.M{"_id": channel.ID},
+			bson.M{
+				"$pull": bson.M{"bundles": bson.M{"bundle_id": bundle.ID}},
+				"$set":  bson.M{"updated_at": now},
+			},
+		)
+		if err != nil {
+			return bundle, refs, fmt.Errorf("unpin bundle from channel %s: %w", channel.Name, err)
+		}
+	}
+
+	InvalidateLatestCache(ctx)
+	return bundle, refs, nil
+}
+
+// Restore undoes Delete of a bundle that's not purged yet. Releases and channels detached by the deletion are not restored.
+func (svc *BundleService) Restore(ctx context.Context, bundle db.Bundle) (db.Bundle, error) {
+	if bundle.DeletedAt == nil {
+		return bundle, ErrBundleNotDeleted
+	}
+
+	result, err := db.Collections().Bundles().UpdateOne(
+		ctx,
+		bson.M{"_id": bundle.ID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+	)
+	if err != nil {
+		return bundle, fmt.Errorf("restore bundle: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return bundle, ErrBundleNotDeleted
+	}
+	bundle.DeletedAt = nil
+	return bundle, nil
+}
+
+// BundleKeys are fingerprints of the keys a bundle is signed and encrypted with by the server. An empty fingerprint
+// means the bundle is not signed or not encrypted.
+type BundleKeys struct {
+	Signing    string
+	Encryption string
+}
+
+// filter matches bundles signed and encrypted with exactly these keys. Bundles stored before fingerprints were stored
+// only match if they are neither signed nor encrypted.
+func (k BundleKeys) filter() bson.M {
+	filter := bson.M{
+		"signing_key_fingerprint":    nil,
+		"encryption_key_fingerprint": nil,
+	}
+	if k.Signing != "" {
+		filter["signing_key_fingerprint"] = k.Signing
+	} else {
+		filter["signed_at"] = nil
+	}
+	if k.Encryption != "" {
+		filter["encryption_key_fingerprint"] = k.Encryption
+	} else {
+		filter["encryption"] = nil
+	}
+	return filter
+}
+
+// FindByContent finds a bundle of the app with the given SHA-256, preferring the one with the version name.
+// If keys are given, only bundles signed and encrypted with the same keys are found, since devices couldn't verify or
+// decrypt a bundle processed with a previous key. Deleted bundles are not found.
+func (svc *BundleService) FindByContent(ctx context.Context, appID string, sha256 string, versionName string, keys *BundleKeys) (db.Bundle, error) {
+	var bundle db.Bundle
+	filter := bson.M{"app_id": appID, "sha256": sha256, "deleted_at": nil, "version_name": versionName}
+	if keys != nil {
+		for k, v := range keys.filter() {
+			filter[k] = v
+		}
+	}
+	err := db.Collections().Bundles().FindOne(ctx, filter).Decode(&bundle)
+	if err == nil {
+		return bundle, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return bundle, err
+	}
+
+	delete(filter, "version_name")
+	err = db.Collections().Bundles().FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&bundle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return bundle, ErrBundleNotFound
+	}
+	return bundle, err
+}
+
+// BundleContentTypeEncrypted is the MIME type of an encrypted bundle object.
+const BundleContentTypeEncrypted = "application/octet-stream"
+
+// DetectBundleContentType sniffs the MIME type of an unencrypted bundle from its first bytes, e.g. application/zip.
+func DetectBundleContentType(r io.Reader) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// IsSHA256Checksum reports whether the checksum is a hex encoded SHA-256, instead of a CRC32.
+func IsSHA256Checksum(checksum string) bool {
+	if len(checksum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil
+}
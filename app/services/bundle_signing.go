@@ -0,0 +1,98 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tanapoln/capgo-server/config"
+)
+
+var (
+	bundleSignerOnce sync.Once
+	bundleSigner     *BundleSigner
+	bundleSignerErr  error
+)
+
+// BundleSigner signs bundle zip files in the format verified by Capgo plugin.
+// RSA keys produce a SHA512withRSA (PKCS#1 v1.5) signature, Ed25519 keys sign the zip file itself.
+// Signatures are base64 encoded.
+type BundleSigner struct {
+	key         crypto.Signer
+	fingerprint string
+}
+
+// DefaultBundleSigner returns a signer of the configured signing key, or nil if bundle signing is not configured.
+func DefaultBundleSigner() (*BundleSigner, error) {
+	bundleSignerOnce.Do(func() {
+		value := config.Get().BundleSigningPrivateKey
+		if value == "" {
+			return
+		}
+		bundleSigner, bundleSignerErr = NewBundleSigner(value)
+	})
+	return bundleSigner, bundleSignerErr
+}
+
+// NewBundleSigner creates a signer from a PEM encoded private key or a path to it.
+func NewBundleSigner(privateKey string) (*BundleSigner, error) {
+	key, err := loadPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("load bundle signing key: %w", err)
+	}
+	return newBundleSigner(key)
+}
+
+// NewBundleSignerFromPEM creates a signer from a PEM encoded private key. Unlike NewBundleSigner, the key can't be a path,
+// so it's used for keys provided via the API.
+func NewBundleSignerFromPEM(privateKey string) (*BundleSigner, error) {
+	key, err := parsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse bundle signing key: %w", err)
+	}
+	return newBundleSigner(key)
+}
+
+func newBundleSigner(key crypto.Signer) (*BundleSigner, error) {
+	fingerprint, err := publicKeyFingerprint(key)
+	if err != nil {
+		return nil, fmt.Errorf("bundle signing key: %w", err)
+	}
+	return &BundleSigner{key: key, fingerprint: fingerprint}, nil
+}
+
+// Fingerprint identifies the signing key, so bundles signed with another key can be told apart.
+func (s *BundleSigner) Fingerprint() string {
+	return s.fingerprint
+}
+
+func (s *BundleSigner) Sign(r io.Reader) (string, error) {
+	var sig []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		hash := sha512.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return "", err
+		}
+		b, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA512, hash.Sum(nil))
+		if err != nil {
+			return "", err
+		}
+		sig = b
+	case ed25519.PrivateKey:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		sig = ed25519.Sign(key, data)
+	default:
+		return "", fmt.Errorf("unsupported signing key type %T", s.key)
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
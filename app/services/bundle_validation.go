@@ -0,0 +1,167 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+)
+
+const (
+	BundleSourceMapsWarn   = "warn"
+	BundleSourceMapsReject = "reject"
+	BundleSourceMapsAllow  = "allow"
+)
+
+// maxBundleValidationIssues bounds the report stored on the bundle, e.g. for a bundle with thousands of source maps.
+// Errors and warnings are bounded separately, so warnings never push errors out of the report.
+const maxBundleValidationIssues = 100
+
+// BundleValidator validates uploaded bundle zip files. Zero limits are disabled.
+type BundleValidator struct {
+	MaxSize             int64
+	MaxUncompressedSize int64
+	MaxFiles            int
+	RequireIndexHTML    bool
+	SourceMaps          string
+}
+
+func NewBundleValidatorFromConfig() *BundleValidator {
+	cfg := config.Get()
+	return &BundleValidator{
+		MaxSize:             cfg.BundleMaxSize,
+		MaxUncompressedSize: cfg.BundleMaxUncompressedSize,
+		MaxFiles:            cfg.BundleMaxFiles,
+		RequireIndexHTML:    cfg.BundleRequireIndexHTML,
+		SourceMaps:          cfg.BundleSourceMaps,
+	}
+}
+
+// bundleValidation collects issues of a single bundle.
+type bundleValidation struct {
+	report   db.BundleValidationReport
+	warnings int
+}
+
+func (v *bundleValidation) add(severity db.BundleValidationSeverity, check string, path string, format string, args ...any) {
+	if severity == db.BundleValidationError {
+		v.report.Errors++
+		if v.report.Errors > maxBundleValidationIssues {
+			v.report.Truncated = true
+			return
+		}
+	} else {
+		v.warnings++
+		if v.warnings > maxBundleValidationIssues {
+			v.report.Truncated = true
+			return
+		}
+	}
+	v.report.Issues = append(v.report.Issues, db.BundleValidationIssue{
+		Check:    check,
+		Severity: severity,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate inspects the bundle zip file. Issues are returned in the report, and an error only if the file isn't a zip file.
+// Sizes are the ones declared by the zip file, the content is not decompressed.
+func (validator *BundleValidator) Validate(r io.ReaderAt, size int64) (db.BundleValidationReport, error) {
+	v := validator.validateSize(size)
+	v.report.Inspected = true
+
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return v.report, err
+	}
+
+	topLevel := map[string]struct{}{}
+	hasIndexHTML := false
+	for _, f := range z.File {
+		name := f.Name
+		if top, _, _ := strings.Cut(name, "/"); top != "" && top != "__MACOSX" {
+			topLevel[top] = struct{}{}
+		}
+
+		if isUnsafeZipPath(name) {
+			v.add(db.BundleValidationError, "path_traversal", name, "path escapes the bundle directory")
+		}
+		if f.Mode()&fs.ModeSymlink != 0 {
+			v.add(db.BundleValidationError, "symlink", name, "symbolic links are not allowed")
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		v.report.Files++
+		v.report.UncompressedSize += int64(f.UncompressedSize64)
+		if name == "index.html" {
+			hasIndexHTML = true
+		}
+		if strings.HasSuffix(strings.ToLower(name), ".map") {
+			switch validator.SourceMaps {
+			case BundleSourceMapsAllow:
+			case BundleSourceMapsReject:
+				v.add(db.BundleValidationError, "source_map", name, "source maps are not allowed (%d bytes)", f.UncompressedSize64)
+			default:
+				v.add(db.BundleValidationWarning, "source_map", name, "source map is shipped to devices (%d bytes)", f.UncompressedSize64)
+			}
+		}
+	}
+
+	if validator.MaxFiles > 0 && v.report.Files > validator.MaxFiles {
+		v.add(db.BundleValidationError, "max_files", "", "bundle has %d files, more than %d", v.report.Files, validator.MaxFiles)
+	}
+	if validator.MaxUncompressedSize > 0 && v.report.UncompressedSize > validator.MaxUncompressedSize {
+		v.add(db.BundleValidationError, "max_uncompressed_size", "", "uncompressed size is %d bytes, more than %d bytes", v.report.UncompressedSize, validator.MaxUncompressedSize)
+	}
+	if validator.RequireIndexHTML && !hasIndexHTML {
+		if len(topLevel) == 1 {
+			for top := range topLevel {
+				v.add(db.BundleValidationError, "index_html", "", "index.html is not at the root, zip the contents of %s/ instead of the folder itself", top)
+			}
+		} else {
+			v.add(db.BundleValidationError, "index_html", "", "index.html is not at the root")
+		}
+	}
+	return v.report, nil
+}
+
+// ValidateEncrypted validates a bundle encrypted by Capgo CLI, which can't be inspected, so only its size is validated.
+func (validator *BundleValidator) ValidateEncrypted(size int64) db.BundleValidationReport {
+	return validator.validateSize(size).report
+}
+
+func (validator *BundleValidator) validateSize(size int64) *bundleValidation {
+	v := &bundleValidation{
+		report: db.BundleValidationReport{
+			CompressedSize: size,
+			Issues:         []db.BundleValidationIssue{},
+			ValidatedAt:    time.Now(),
+		},
+	}
+	if validator.MaxSize > 0 && size > validator.MaxSize {
+		v.add(db.BundleValidationError, "max_size", "", "bundle is %d bytes, more than %d bytes", size, validator.MaxSize)
+	}
+	return v
+}
+
+// isUnsafeZipPath reports whether the zip entry would be extracted outside of the bundle directory.
+func isUnsafeZipPath(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/tanapoln/capgo-server/app/db"
+)
+
+func zipBundle(t *testing.T, names ...string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("content")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func hasIssue(report db.BundleValidationReport, check string) bool {
+	for _, issue := range report.Issues {
+		if issue.Check == check {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBundleValidatorKeepsErrorsAfterManyWarnings(t *testing.T) {
+	names := []string{"index.html"}
+	for i := 0; i <= maxBundleValidationIssues; i++ {
+		names = append(names, fmt.Sprintf("js/chunk-%d.js.map", i))
+	}
+	names = append(names, "../escape.js")
+
+	validator := &BundleValidator{RequireIndexHTML: true, SourceMaps: BundleSourceMapsWarn}
+	r := zipBundle(t, names...)
+	report, err := validator.Validate(r, r.Size())
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if !report.HasErrors() {
+		t.Errorf("HasErrors() = false, want true")
+	}
+	if !hasIssue(report, "path_traversal") {
+		t.Errorf("path_traversal issue is missing from the report")
+	}
+	if !report.Truncated {
+		t.Errorf("Truncated = false, want true")
+	}
+	if report.Errors != 1 {
+		t.Errorf("Errors = %d, want 1", report.Errors)
+	}
+}
+
+func TestBundleValidatorCountsTruncatedErrors(t *testing.T) {
+	names := []string{"index.html"}
+	for i := 0; i <= maxBundleValidationIssues; i++ {
+		names = append(names, fmt.Sprintf("../escape-%d.js", i))
+	}
+
+	validator := &BundleValidator{RequireIndexHTML: true, SourceMaps: BundleSourceMapsWarn}
+	r := zipBundle(t, names...)
+	report, err := validator.Validate(r, r.Size())
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if !report.HasErrors() || !report.Truncated {
+		t.Errorf("HasErrors() = %v, Truncated = %v, want both true", report.HasErrors(), report.Truncated)
+	}
+	if report.Errors != maxBundleValidationIssues+1 {
+		t.Errorf("Errors = %d, want %d", report.Errors, maxBundleValidationIssues+1)
+	}
+	if len(report.Issues) != maxBundleValidationIssues {
+		t.Errorf("len(Issues) = %d, want %d", len(report.Issues), maxBundleValidationIssues)
+	}
+}
+
+func TestBundleValidatorAcceptsValidBundle(t *testing.T) {
+	validator := &BundleValidator{RequireIndexHTML: true, SourceMaps: BundleSourceMapsWarn, MaxFiles: 10}
+	r := zipBundle(t, "index.html", "js/app.js", "js/app.js.map")
+	report, err := validator.Validate(r, r.Size())
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if report.HasErrors() {
+		t.Errorf("HasErrors() = true, issues: %+v", report.Issues)
+	}
+	if !hasIssue(report, "source_map") || report.Files != 3 {
+		t.Errorf("report = %+v", report)
+	}
+}
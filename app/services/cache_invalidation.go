@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const latestCacheVersionID = "get_latest"
+
+var (
+	cacheVersionMu   sync.Mutex
+	seenCacheVersion int64
+)
+
+// InvalidateLatestCache removes every cached GetLatest lookup, so the next update check reads the latest data.
+// Other replicas are notified through the shared cache version and flush their cache within the poll interval.
+func InvalidateLatestCache(ctx context.Context) {
+	cacheStore().Flush()
+
+	var version db.CacheVersion
+	err := db.Collections().CacheVersions().FindOneAndUpdate(
+		context.WithoutCancel(ctx),
+		bson.M{"_id": latestCacheVersionID},
+		bson.M{
+			"$inc":         bson.M{"version": 1},
+			"$currentDate": bson.M{"updated_at": true},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&version)
+	if err != nil {
+		slog.Error("Failed to publish cache invalidation, other replicas keep their cache until it expires", "error", err)
+		return
+	}
+
+	// Skip the redundant flush on the next poll, unless another replica invalidated the cache in the meantime.
+	cacheVersionMu.Lock()
+	if version.Version == seenCacheVersion+1 {
+		seenCacheVersion = version.Version
+	}
+	cacheVersionMu.Unlock()
+}
+
+// StartCacheInvalidationListener periodically checks the shared cache version and flushes the local GetLatest cache
+// when another replica invalidated it. Calling the returned stop function waits for the listener to exit.
+func StartCacheInvalidationListener() (stop func()) {
+	interval := config.Get().CachePollInterval
+	if interval <= 0 {
+		slog.Info("Cache invalidation listener is disabled")
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if version, err := loadLatestCacheVersion(ctx); err != nil {
+		slog.Error("Failed to load cache version", "error", err)
+	} else {
+		seenCacheVersion = version
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := checkLatestCacheVersion(ctx); err != nil {
+					slog.Error("Failed to check cache version", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func checkLatestCacheVersion(ctx context.Context) error {
+	version, err := loadLatestCacheVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	cacheVersionMu.Lock()
+	defer cacheVersionMu.Unlock()
+	if version != seenCacheVersion {
+		cacheStore().Flush()
+		seenCacheVersion = version
+	}
+	return nil
+}
+
+func loadLatestCacheVersion(ctx context.Context) (int64, error) {
+	var version db.CacheVersion
+	err := db.Collections().CacheVersions().FindOne(ctx, bson.M{"_id": latestCacheVersionID}).Decode(&version)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return version.Version, nil
+}
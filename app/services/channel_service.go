@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ChannelService struct {
+}
+
+// SetDeviceChannel assigns a device to a channel. The channel must exist and allow device self assignment.
+func (svc *ChannelService) SetDeviceChannel(ctx context.Context, appID string, deviceID string, channelName string) error {
+	channel, err := findChannel(ctx, appID, channelName)
+	if err != nil {
+		return err
+	}
+	if !channel.AllowDeviceSelfSet {
+		return ErrChannelSelfSetNotAllowed
+	}
+
+	now := time.Now()
+	_, err = db.Collections().DeviceChannels().UpdateOne(
+		ctx,
+		bson.M{
+			"app_id":    appID,
+			"device_id": deviceID,
+		},
+		bson.M{
+			"$set": bson.M{
+				"channel":    channel.Name,
+				"updated_at": now,
+			},
+			"$setOnInsert": bson.M{
+				"_id":        primitive.NewObjectID(),
+				"created_at": now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	cacheStore().Delete(deviceChannelCacheKey(appID, deviceID))
+	return err
+}
+
+// UnsetDeviceChannel removes a channel assignment of a device. It's not an error if the device is not assigned.
+func (svc *ChannelService) UnsetDeviceChannel(ctx context.Context, appID string, deviceID string) error {
+	_, err := db.Collections().DeviceChannels().DeleteOne(ctx, bson.M{
+		"app_id":    appID,
+		"device_id": deviceID,
+	})
+	cacheStore().Delete(deviceChannelCacheKey(appID, deviceID))
+	return err
+}
+
+// GetDeviceChannel returns a channel name assigned to the device, or empty string if the device is not assigned.
+// Assignments are cached briefly, since they are looked up on every update check of the device. The cache is cleared
+// when the device changes its channel on this replica, other replicas see the change once it expires.
+func (svc *ChannelService) GetDeviceChannel(ctx context.Context, appID string, deviceID string) (string, error) {
+	return fromCacheFor(deviceChannelCacheKey(appID, deviceID), config.Get().DeviceChannelCacheTTL, func() (string, error) {
+		return findDeviceChannel(ctx, appID, deviceID)
+	})
+}
+
+func deviceChannelCacheKey(appID string, deviceID string) string {
+	return fmt.Sprintf("device_channel|%s|%s", appID, deviceID)
+}
+
+func findDeviceChannel(ctx context.Context, appID string, deviceID string) (string, error) {
+	var assignment db.DeviceChannel
+	err := db.Collections().DeviceChannels().FindOne(ctx, bson.M{
+		"app_id":    appID,
+		"device_id": deviceID,
+	}).Decode(&assignment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+	return assignment.Channel, nil
+}
+
+func findChannel(ctx context.Context, appID string, name string) (db.Channel, error) {
+	var channel db.Channel
+	err := db.Collections().Channels().FindOne(ctx, bson.M{
+		"app_id": appID,
+		"name":   name,
+	}).Decode(&channel)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return db.Channel{}, ErrChannelNotFound
+		}
+		return db.Channel{}, err
+	}
+	return channel, nil
+}
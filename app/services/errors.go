@@ -1,9 +1,27 @@
 package services
 
-import "errors"
+import "github.com/tanapoln/capgo-server/app/apperr"
 
-var ErrReleaseNotFound = errors.New("release is found")
-var ErrInvalidBundleForRelease = errors.New("release contains invalid bundle id")
-var ErrBundleNotFound = errors.New("bundle is not found")
-var ErrGetLatestQueryInvalid = errors.New("GetLatest information is incompleted, cannot find the latest release")
-var ErrCacheInvalid = errors.New("unexpected error (cache issue)")
+var ErrReleaseNotFound = apperr.New(apperr.KindNotFound, "release_not_found", "release is not found")
+var ErrInvalidBundleForRelease = apperr.New(apperr.KindUnprocessable, "invalid_bundle_for_release", "release contains invalid bundle id")
+var ErrBundleNotFound = apperr.New(apperr.KindNotFound, "bundle_not_found", "bundle is not found")
+var ErrGetLatestQueryInvalid = apperr.New(apperr.KindInvalid, "invalid_update_query", "GetLatest information is incompleted, cannot find the latest release")
+var ErrCacheInvalid = apperr.New(apperr.KindInternal, "cache_invalid", "unexpected error (cache issue)")
+var ErrChannelNotFound = apperr.New(apperr.KindNotFound, "channel_not_found", "channel is not found")
+var ErrChannelSelfSetNotAllowed = apperr.New(apperr.KindUnprocessable, "channel_self_set_not_allowed", "channel does not allow device self assignment")
+var ErrStatsQueueFull = apperr.New(apperr.KindUnavailable, "stats_queue_full", "stats queue is full, event is dropped")
+var ErrReleaseModified = apperr.New(apperr.KindConflict, "release_modified", "release was modified concurrently, please retry")
+var ErrBundleDownloadURLInvalid = apperr.New(apperr.KindInvalid, "bundle_download_url_invalid", "bundle download url is invalid or expired")
+var ErrBundleDownloadURLModeInvalid = apperr.New(apperr.KindInternal, "bundle_download_url_mode_invalid", "bundle download url mode is invalid")
+var ErrBundleInUse = apperr.New(apperr.KindConflict, "bundle_in_use", "bundle is used by a release or a channel, delete with force to detach it")
+var ErrBundleIsBuiltin = apperr.New(apperr.KindConflict, "bundle_is_builtin", "bundle is the builtin bundle of a release, delete the release first")
+var ErrBundleInRollout = apperr.New(apperr.KindConflict, "bundle_in_rollout", "bundle is used by a running rollout, advance or abort the rollout first")
+var ErrBundleDeleted = apperr.New(apperr.KindConflict, "bundle_deleted", "bundle is already deleted")
+var ErrBundleNotDeleted = apperr.New(apperr.KindConflict, "bundle_not_deleted", "bundle is not deleted")
+var ErrBundleEncrypted = apperr.New(apperr.KindUnprocessable, "bundle_encrypted", "bundle is encrypted, the original zip file is not available")
+var ErrAppNotFound = apperr.New(apperr.KindNotFound, "app_not_found", "app is not found")
+var ErrAppKeyInvalid = apperr.New(apperr.KindUnprocessable, "app_key_invalid", "app private key is invalid, it must be set again as a PEM encoded key")
+var ErrAppPlatformNotAllowed = apperr.New(apperr.KindUnprocessable, "app_platform_not_allowed", "platform is not allowed for the app")
+var ErrOrganizationNotFound = apperr.New(apperr.KindNotFound, "organization_not_found", "organization is not found")
+var ErrWebhookDeliveryNotFound = apperr.New(apperr.KindNotFound, "webhook_delivery_not_found", "webhook delivery is not found")
+var ErrApiTokenInvalid = apperr.New(apperr.KindUnauthorized, "api_token_invalid", "api token is invalid or expired")
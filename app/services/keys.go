@@ -0,0 +1,65 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadPrivateKey loads a PEM encoded private key either from the value itself or, if the value is not PEM, from a file path.
+// Paths are only allowed for keys of the server config. Keys provided via the API are parsed with parsePrivateKeyPEM,
+// so they can't point to files on the server.
+func loadPrivateKey(value string) (crypto.Signer, error) {
+	if !strings.Contains(value, "-----BEGIN") {
+		b, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("read private key file: %w", err)
+		}
+		value = string(b)
+	}
+	return parsePrivateKeyPEM(value)
+}
+
+// parsePrivateKeyPEM parses a PEM encoded private key. PKCS#1 RSA keys and PKCS#8 RSA or Ed25519 keys are supported.
+func parsePrivateKeyPEM(value string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// publicKeyFingerprint returns a hex encoded SHA-256 of the PKIX encoded public key of the private key.
+func publicKeyFingerprint(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("marshal public key: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReleaseService struct {
+}
+
+// SetActiveBundle changes the active bundle of the release and remembers the previous one. Nil bundleID reverts the release
+// to its builtin bundle. extraSet is applied in the same update, e.g. for changing a rollout together with the active bundle.
+// The update fails with ErrReleaseModified if the active bundle was changed by someone else in the meantime.
+// Webhooks of the app are notified when the active bundle is changed.
+func (svc *ReleaseService) SetActiveBundle(ctx context.Context, release db.Release, bundleID *primitive.ObjectID, extraSet bson.M) (db.Release, error) {
+	now := time.Now()
+	set := bson.M{
+		"active_bundle_id":     bundleID,
+		"active_bundle_set_at": now,
+		"updated_at":           now,
+	}
+	update := bson.M{"$set": set}
+	changed := !sameBundleID(release.ActiveBundleID, bundleID)
+	if changed {
+		set["previous_active_bundle_id"] = release.ActiveBundleID
+		update["$push"] = bson.M{
+			"active_bundle_history": bson.M{
+				"$each":  []db.ActiveBundleChange{{BundleID: bundleID, At: now}},
+				"$slice": -db.MaxActiveBundleHistory,
+			},
+		}
+	}
+	for k, v := range extraSet {
+		set[k] = v
+	}
+
+	result, err := db.Collections().Releases().UpdateOne(
+		ctx,
+		bson.M{
+			"_id":              release.ID,
+			"active_bundle_id": release.ActiveBundleID,
+		},
+		update,
+	)
+	if err != nil {
+		return release, err
+	}
+	if result.MatchedCount == 0 {
+		return release, ErrReleaseModified
+	}
+
+	err = db.Collections().Releases().FindOne(ctx, bson.M{"_id": release.ID}).Decode(&release)
+	if err != nil {
+		return release, err
+	}
+
+	InvalidateLatestCache(ctx)
+	if changed {
+		(&WebhookService{}).Dispatch(ctx, release.AppID, db.WebhookEventActiveBundleChanged, NewWebhookReleaseData(release))
+	}
+	return release, nil
+}
+
+func sameBundleID(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
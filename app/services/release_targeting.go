@@ -0,0 +1,183 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/tanapoln/capgo-server/app/apperr"
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/semver"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// findRelease finds the release of a native build. A release with the exact version name and version code always wins.
+// Otherwise, the most specific matching targeting rule wins, that is the rule with the narrowest version range, then the
+// narrowest version code bounds. For example, "2.3.x" wins over "^2.3.0", which wins over "2.x", which wins over
+// ">=2.0.0", which wins over "*". Ties are won by the latest created release.
+func findRelease(ctx context.Context, query GetLatestQuery) (db.Release, error) {
+	var release db.Release
+	err := db.Collections().Releases().FindOne(ctx, bson.M{
+		"platform":     query.Platform,
+		"app_id":       query.AppID,
+		"version_name": query.VersionName,
+		"version_code": query.VersionCode,
+	}).Decode(&release)
+	if err == nil {
+		return release, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return db.Release{}, err
+	}
+
+	cursor, err := db.Collections().Releases().Find(ctx, bson.M{
+		"platform":  query.Platform,
+		"app_id":    query.AppID,
+		"targeting": bson.M{"$exists": true, "$ne": nil},
+	})
+	if err != nil {
+		return db.Release{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var candidates []db.Release
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return db.Release{}, err
+	}
+
+	release, found := selectTargetedRelease(candidates, query.VersionName, query.VersionCode)
+	if !found {
+		return db.Release{}, ErrBundleNotFound
+	}
+	return release, nil
+}
+
+// selectTargetedRelease returns the release with the most specific targeting rule matching the native build.
+func selectTargetedRelease(candidates []db.Release, versionName string, versionCode string) (db.Release, bool) {
+	var release db.Release
+	var best releaseTargetingSpecificity
+	found := false
+	for _, candidate := range candidates {
+		if candidate.Targeting == nil {
+			continue
+		}
+		specificity, ok := matchReleaseTargeting(*candidate.Targeting, versionName, versionCode)
+		if !ok {
+			continue
+		}
+		c := -1
+		if found {
+			c = specificity.compare(best)
+		}
+		if c < 0 || (c == 0 && candidate.CreatedAt.After(release.CreatedAt)) {
+			release = candidate
+			best = specificity
+			found = true
+		}
+	}
+	return release, found
+}
+
+// releaseTargetingSpecificity is how narrow the part of a targeting rule matching a native build is.
+type releaseTargetingSpecificity struct {
+	versions       semver.Interval
+	minVersionCode *int64
+	maxVersionCode *int64
+}
+
+// compare returns -1, 0 or 1 if s is more specific than, as specific as or less specific than o. The version range is
+// compared first, and the version code bounds only break ties.
+func (s releaseTargetingSpecificity) compare(o releaseTargetingSpecificity) int {
+	if c := s.versions.Compare(o.versions); c != 0 {
+		return c
+	}
+	return compareVersionCodeBounds(s, o)
+}
+
+// compareVersionCodeBounds compares version code bounds the same way as semver.Interval.Compare: fewer unbounded sides
+// first, then the distance between the bounds, or the bound of the same side.
+func compareVersionCodeBounds(s, o releaseTargetingSpecificity) int {
+	unbounded := func(min, max *int64) int {
+		n := 0
+		if min == nil {
+			n++
+		}
+		if max == nil {
+			n++
+		}
+		return n
+	}
+	if c := cmp.Compare(unbounded(s.minVersionCode, s.maxVersionCode), unbounded(o.minVersionCode, o.maxVersionCode)); c != 0 {
+		return c
+	}
+	switch {
+	case s.minVersionCode != nil && s.maxVersionCode != nil:
+		return cmp.Compare(*s.maxVersionCode-*s.minVersionCode, *o.maxVersionCode-*o.minVersionCode)
+	case s.minVersionCode != nil && o.minVersionCode != nil:
+		return cmp.Compare(*o.minVersionCode, *s.minVersionCode)
+	case s.maxVersionCode != nil && o.maxVersionCode != nil:
+		return cmp.Compare(*s.maxVersionCode, *o.maxVersionCode)
+	}
+	return 0
+}
+
+// matchReleaseTargeting reports whether the native build matches the rule, and how specific the matched part of the rule is.
+func matchReleaseTargeting(t db.ReleaseTargeting, versionName string, versionCode string) (releaseTargetingSpecificity, bool) {
+	specificity := releaseTargetingSpecificity{
+		minVersionCode: t.MinVersionCode,
+		maxVersionCode: t.MaxVersionCode,
+	}
+
+	if t.VersionRange != "" {
+		r, err := semver.ParseRange(t.VersionRange)
+		if err != nil {
+			return releaseTargetingSpecificity{}, false
+		}
+		// A wildcard also matches version names that aren't semantic versions.
+		v, err := semver.Parse(versionName)
+		if err != nil {
+			if !r.MatchesAll() {
+				return releaseTargetingSpecificity{}, false
+			}
+		} else {
+			interval, ok := r.Match(v)
+			if !ok {
+				return releaseTargetingSpecificity{}, false
+			}
+			specificity.versions = interval
+		}
+	}
+
+	if t.MinVersionCode != nil || t.MaxVersionCode != nil {
+		code, err := strconv.ParseInt(versionCode, 10, 64)
+		if err != nil {
+			return releaseTargetingSpecificity{}, false
+		}
+		if t.MinVersionCode != nil && code < *t.MinVersionCode {
+			return releaseTargetingSpecificity{}, false
+		}
+		if t.MaxVersionCode != nil && code > *t.MaxVersionCode {
+			return releaseTargetingSpecificity{}, false
+		}
+	}
+
+	return specificity, true
+}
+
+// ValidateReleaseTargeting checks that the rule has at least one condition and that every condition is valid.
+func ValidateReleaseTargeting(t db.ReleaseTargeting) error {
+	if t.VersionRange == "" && t.MinVersionCode == nil && t.MaxVersionCode == nil {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "targeting requires a version range or a version code bound, use \"*\" version range to match every build")
+	}
+	if t.VersionRange != "" {
+		if _, err := semver.ParseRange(t.VersionRange); err != nil {
+			return apperr.Invalid(apperr.CodeInvalidRequest, "invalid version range: %v", err)
+		}
+	}
+	if t.MinVersionCode != nil && t.MaxVersionCode != nil && *t.MinVersionCode > *t.MaxVersionCode {
+		return apperr.Invalid(apperr.CodeInvalidRequest, "min version code %d is greater than max version code %d", *t.MinVersionCode, *t.MaxVersionCode)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+)
+
+func TestSelectTargetedRelease(t *testing.T) {
+	type rule struct {
+		name           string
+		versionRange   string
+		minVersionCode *int64
+		maxVersionCode *int64
+	}
+	code := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name        string
+		rules       []rule
+		versionName string
+		versionCode string
+		want        string
+	}{
+		{
+			name:        "exact version wins over wider ranges",
+			rules:       []rule{{name: "exact", versionRange: "2.3.0"}, {name: "major", versionRange: "2.x"}, {name: "caret", versionRange: "^2.3.0"}},
+			versionName: "2.3.0",
+			want:        "exact",
+		},
+		{
+			name:        "minor wildcard wins over major wildcard",
+			rules:       []rule{{name: "minor", versionRange: "2.3.x"}, {name: "major", versionRange: "2.x"}},
+			versionName: "2.3.4",
+			want:        "minor",
+		},
+		{
+			name:        "partial version is a wildcard",
+			rules:       []rule{{name: "partial", versionRange: "2"}, {name: "any", versionRange: "*"}},
+			versionName: "2.3.4",
+			want:        "partial",
+		},
+		{
+			name:        "caret wins over explicit major bounds",
+			rules:       []rule{{name: "bounds", versionRange: ">=2.0.0 <3.0.0"}, {name: "caret", versionRange: "^2.3.0"}},
+			versionName: "2.5.0",
+			want:        "caret",
+		},
+		{
+			name:        "bounded range wins over open range",
+			rules:       []rule{{name: "open", versionRange: ">=2.3.0"}, {name: "bounded", versionRange: ">=2.0.0 <3.0.0"}},
+			versionName: "2.5.0",
+			want:        "bounded",
+		},
+		{
+			name:        "narrowest alternative is used",
+			rules:       []rule{{name: "alternatives", versionRange: "1.x || 2.3.0"}, {name: "minor", versionRange: "2.3.x"}},
+			versionName: "2.3.0",
+			want:        "alternatives",
+		},
+		{
+			name:        "version code bounds break ties",
+			rules:       []rule{{name: "min", versionRange: "2.x", minVersionCode: code(100)}, {name: "both", versionRange: "2.x", minVersionCode: code(100), maxVersionCode: code(199)}, {name: "none", versionRange: "2.x"}},
+			versionName: "2.3.0",
+			versionCode: "150",
+			want:        "both",
+		},
+		{
+			name:        "version range wins over version code bounds",
+			rules:       []rule{{name: "codes", minVersionCode: code(100), maxVersionCode: code(199)}, {name: "range", versionRange: "2.3.x"}},
+			versionName: "2.3.0",
+			versionCode: "150",
+			want:        "range",
+		},
+		{
+			name:        "non matching rules are ignored",
+			rules:       []rule{{name: "exact", versionRange: "2.3.1"}, {name: "codes", versionRange: "2.x", maxVersionCode: code(99)}, {name: "major", versionRange: "2.x"}},
+			versionName: "2.3.0",
+			versionCode: "150",
+			want:        "major",
+		},
+		{
+			name:        "wildcard matches non semver version names",
+			rules:       []rule{{name: "major", versionRange: "2.x"}, {name: "any", versionRange: "*"}},
+			versionName: "nightly",
+			want:        "any",
+		},
+		{
+			name:        "latest created release wins ties",
+			rules:       []rule{{name: "first", versionRange: "2.x"}, {name: "second", versionRange: ">=2.0.0 <3.0.0"}},
+			versionName: "2.3.0",
+			want:        "second",
+		},
+		{
+			name:        "no rule matches",
+			rules:       []rule{{name: "major", versionRange: "3.x"}},
+			versionName: "2.3.0",
+			want:        "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := time.Now()
+			var candidates []db.Release
+			for _, r := range tt.rules {
+				created = created.Add(time.Minute)
+				candidates = append(candidates, db.Release{
+					VersionName: r.name,
+					CreatedAt:   created,
+					Targeting: &db.ReleaseTargeting{
+						VersionRange:   r.versionRange,
+						MinVersionCode: r.minVersionCode,
+						MaxVersionCode: r.maxVersionCode,
+					},
+				})
+			}
+
+			release, found := selectTargetedRelease(candidates, tt.versionName, tt.versionCode)
+			if found != (tt.want != "") {
+				t.Fatalf("selectTargetedRelease() found = %v, want %v", found, tt.want != "")
+			}
+			if release.VersionName != tt.want {
+				t.Errorf("selectTargetedRelease() = %q, want %q", release.VersionName, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	StatsActionSet              = "set"
+	StatsActionDownloadComplete = "download_complete"
+)
+
+// StatsFailureActions are Capgo stats actions that indicate a bundle failed to download or to be applied.
+var StatsFailureActions = []string{
+	"set_fail",
+	"update_fail",
+	"download_fail",
+	"unzip_fail",
+	"checksum_fail",
+	"decrypt_fail",
+	"low_mem_fail",
+}
+
+var statsActionPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// statsQueue is created on first use, since its size is configured.
+var statsQueue = sync.OnceValue(func() chan db.StatsEvent {
+	return make(chan db.StatsEvent, config.Get().StatsQueueSize)
+})
+
+func IsValidStatsAction(action string) bool {
+	return statsActionPattern.MatchString(action)
+}
+
+type StatsService struct {
+}
+
+// Record queues an event to be written by the stats writer. It never blocks; the event is dropped if the queue is full.
+func (svc *StatsService) Record(event db.StatsEvent) error {
+	select {
+	case statsQueue() <- event:
+		return nil
+	default:
+		return ErrStatsQueueFull
+	}
+}
+
+type BundleStats struct {
+	VersionName string `bson:"_id"`
+	Downloads   int64  `bson:"downloads"`
+	Sets        int64  `bson:"sets"`
+	Failures    int64  `bson:"failures"`
+}
+
+// StatsFilter narrows down stats events to be counted. Empty fields are not filtered.
+type StatsFilter struct {
+	AppID        string
+	VersionNames []string
+	Platform     db.Platform
+	// VersionBuild and VersionCode are the native version of the device, i.e. a release.
+	VersionBuild string
+	VersionCode  string
+	Since        time.Time
+	// After skips version names up to and including it, for paginating counts sorted by version name.
+	After string
+	// Limit is the maximum number of counts returned. Zero is unlimited.
+	Limit int
+}
+
+// CountByVersionName counts downloads, successful sets and failures per bundle version name, sorted by version name.
+func (svc *StatsService) CountByVersionName(ctx context.Context, filter StatsFilter) ([]BundleStats, error) {
+	match := bson.M{"app_id": filter.AppID}
+	versionName := bson.M{}
+	if len(filter.VersionNames) > 0 {
+		versionName["$in"] = filter.VersionNames
+	}
+	if filter.After != "" {
+		versionName["$gt"] = filter.After
+	}
+	if len(versionName) > 0 {
+		match["version_name"] = versionName
+	}
+	if filter.Platform != "" {
+		match["platform"] = filter.Platform
+	}
+	if filter.VersionBuild != "" {
+		match["version_build"] = filter.VersionBuild
+	}
+	if filter.VersionCode != "" {
+		match["version_code"] = filter.VersionCode
+	}
+	if !filter.Since.IsZero() {
+		match["created_at"] = bson.M{"$gte": filter.Since}
+	}
+
+	countIf := func(cond bson.M) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{cond, 1, 0}}}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id":       "$version_name",
+			"downloads": countIf(bson.M{"$eq": bson.A{"$action", StatsActionDownloadComplete}}),
+			"sets":      countIf(bson.M{"$eq": bson.A{"$action", StatsActionSet}}),
+			"failures":  countIf(bson.M{"$in": bson.A{"$action", StatsFailureActions}}),
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	}
+	if filter.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": filter.Limit})
+	}
+
+	cursor, err := db.Collections().StatsEvents().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []BundleStats
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StartStatsWriter starts writing queued stats events to the database in batches. A batch is written when it's full
+// or every flush interval. Calling the returned stop function flushes the remaining events and waits for the writer to exit.
+func StartStatsWriter() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runStatsWriter(ctx)
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func runStatsWriter(ctx context.Context) {
+	batchSize := max(config.Get().StatsBatchSize, 1)
+	ticker := time.NewTicker(config.Get().StatsFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]db.StatsEvent, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := writeStatsEvents(batch); err != nil {
+			slog.Error("Failed to write stats events", "error", err, "count", len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-statsQueue():
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-statsQueue():
+					batch = append(batch, event)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func writeStatsEvents(events []db.StatsEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	docs := make([]interface{}, len(events))
+	for i, event := range events {
+		docs[i] = event
+	}
+	_, err := db.Collections().StatsEvents().InsertMany(ctx, docs)
+	if err != nil {
+		return fmt.Errorf("insert stats events: %w", err)
+	}
+	return nil
+}
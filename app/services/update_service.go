@@ -2,14 +2,17 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/url"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/semver"
 	"github.com/tanapoln/capgo-server/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,13 +21,16 @@ import (
 
 var (
 	NilLatestResult = GetLatestResult{}
-	cacheStore      = (func() *cache.Cache {
+	// cacheStore is created on first use, since its expiration is configured.
+	cacheStore = sync.OnceValue(func() *cache.Cache {
 		dur := config.Get().CacheResultDuration
 		return cache.New(dur, dur+time.Minute*5)
-	})()
+	})
 )
 
 type UpdateService struct {
+	channelService ChannelService
+	appService     AppService
 }
 
 func (svc *UpdateService) GetLatest(ctx context.Context, query GetLatestQuery) (GetLatestResult, error) {
@@ -33,77 +39,160 @@ func (svc *UpdateService) GetLatest(ctx context.Context, query GetLatestQuery) (
 		return NilLatestResult, ErrGetLatestQueryInvalid
 	}
 
-	doFind := func() (GetLatestResult, error) {
-		var release db.Release
-		err := db.Collections().Releases().FindOne(ctx, bson.M{
-			"platform":     query.Platform,
-			"app_id":       query.AppID,
-			"version_name": query.VersionName,
-			"version_code": query.VersionCode,
-		}).Decode(&release)
+	// Unknown apps are rejected before any release lookup.
+	app, err := fromCache("app|"+query.AppID, func() (db.App, error) {
+		return svc.appService.RequireApp(ctx, query.AppID, "")
+	})
+	if err != nil {
+		return NilLatestResult, err
+	}
+	if !app.AllowsPlatform(query.Platform) {
+		return NilLatestResult, ErrAppPlatformNotAllowed
+	}
+
+	if query.DeviceID != "" {
+		channel, err := svc.channelService.GetDeviceChannel(ctx, query.AppID, query.DeviceID)
 		if err != nil {
-			if errors.Is(err, mongo.ErrNoDocuments) {
-				return NilLatestResult, ErrBundleNotFound
-			}
 			return NilLatestResult, err
 		}
-
-		result := GetLatestResult{
-			Builtin: true,
+		if channel != "" {
+			query.channel = channel
 		}
-		bundleID := release.BuiltinBundleID
-		if release.ActiveBundleID != nil && !release.ActiveBundleID.IsZero() {
-			bundleID = *release.ActiveBundleID
-			result.Builtin = false
+	}
+	if query.channel == "" {
+		query.channel = query.DefaultChannel
+	}
+	if query.channel == "" {
+		query.channel = app.DefaultChannel
+	}
+
+	release, err := fromCache(query.cacheKey(), func() (db.Release, error) {
+		return findRelease(ctx, query)
+	})
+	if err != nil {
+		return NilLatestResult, err
+	}
+
+	if release.Superseded != nil {
+		return GetLatestResult{
+			BreakingChange: release.Superseded,
+		}, nil
+	}
+
+	var channel *db.Channel
+	if query.channel != "" {
+		ch, err := fromCache(fmt.Sprintf("channel|%s|%s", query.AppID, query.channel), func() (db.Channel, error) {
+			return findChannel(ctx, query.AppID, query.channel)
+		})
+		if err != nil && !errors.Is(err, ErrChannelNotFound) {
+			return NilLatestResult, err
 		}
-		if bundleID.IsZero() {
-			return NilLatestResult, ErrInvalidBundleForRelease
+		if err == nil {
+			channel = &ch
 		}
+	}
 
+	bundleID := selectBundleID(release, channel, query.DeviceID)
+	if bundleID.IsZero() {
+		return NilLatestResult, ErrInvalidBundleForRelease
+	}
+
+	bundle, err := fromCache("bundle|"+bundleID.Hex(), func() (db.Bundle, error) {
 		var bundle db.Bundle
-		err = db.Collections().Bundles().FindOne(ctx, bson.M{"_id": bundleID}).Decode(&bundle)
+		err := db.Collections().Bundles().FindOne(ctx, bson.M{"_id": bundleID}).Decode(&bundle)
 		if err != nil {
 			if errors.Is(err, mongo.ErrNoDocuments) {
-				return NilLatestResult, ErrBundleNotFound
+				return db.Bundle{}, ErrBundleNotFound
 			}
-			return NilLatestResult, err
+			return db.Bundle{}, err
 		}
-		result.Bundle = bundle
+		return bundle, nil
+	})
+	if err != nil {
+		return NilLatestResult, err
+	}
 
-		return result, nil
+	return GetLatestResult{
+		Bundle:  bundle,
+		Builtin: bundle.ID == release.BuiltinBundleID,
+	}, nil
+}
+
+// selectBundleID picks a bundle for the device in the following order: the channel bundle for the release,
+// the running rollout, the active bundle and finally the builtin bundle.
+func selectBundleID(release db.Release, channel *db.Channel, deviceID string) primitive.ObjectID {
+	if channel != nil {
+		if bundleID, ok := channel.BundleIDForRelease(release.ID); ok {
+			return bundleID
+		}
+	}
+
+	// A paused rollout keeps devices within its percentage on the rollout bundle, only the percentage doesn't grow.
+	if release.Rollout.IsRunning() {
+		rollout := release.Rollout
+		if RolloutBucket(rollout.BundleID, deviceID) < rollout.Percentage {
+			return rollout.BundleID
+		}
+		return rollout.FallbackBundleID
+	}
+
+	if release.ActiveBundleID != nil && !release.ActiveBundleID.IsZero() {
+		return *release.ActiveBundleID
 	}
+	return release.BuiltinBundleID
+}
+
+// RolloutBucket deterministically places a device into a bucket between 0 and 99. The rollout bundle id is used as a salt,
+// so a device keeps its bucket while the percentage grows, but different rollouts don't always pick the same devices first.
+func RolloutBucket(rolloutBundleID primitive.ObjectID, deviceID string) int {
+	sum := sha256.Sum256([]byte(rolloutBundleID.Hex() + "|" + deviceID))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// fromCache returns a cached value of the key, or calls fn and caches its result. Errors are cached for a shorter duration.
+func fromCache[T any](key string, fn func() (T, error)) (T, error) {
+	return fromCacheFor(key, cache.DefaultExpiration, fn)
+}
+
+// fromCacheFor is fromCache with a custom expiration of a result, e.g. for data that isn't invalidated on every replica.
+func fromCacheFor[T any](key string, expiration time.Duration, fn func() (T, error)) (T, error) {
+	var zero T
 
-	val, found := cacheStore.Get(query.cacheKey())
+	val, found := cacheStore().Get(key)
 	if found {
 		switch v := val.(type) {
-		case GetLatestResult:
+		case T:
 			return v, nil
 		case error:
-			return NilLatestResult, v
+			return zero, v
 		default:
-			return NilLatestResult, ErrCacheInvalid
+			return zero, ErrCacheInvalid
 		}
 	}
 
-	result, err := doFind()
+	result, err := fn()
 	if err != nil {
-		cacheStore.Set(query.cacheKey(), err, 5*time.Minute)
-		return NilLatestResult, err
+		cacheStore().Set(key, err, config.Get().CacheErrorDuration)
+		return zero, err
 	}
-	cacheStore.Set(query.cacheKey(), result, cache.DefaultExpiration)
+	cacheStore().Set(key, result, expiration)
 	return result, nil
 }
 
-func (svc *UpdateService) CreateBundleDownloadURL(ctx context.Context, bundleID primitive.ObjectID) (*url.URL, error) {
-	//TODO: secure bundle download url will be implemented in the future
-	return nil, nil
-}
-
 type GetLatestQuery struct {
 	AppID       string
 	Platform    db.Platform
 	VersionName string
 	VersionCode string
+
+	// DeviceID is used for looking up a channel that the device assigned itself to, and for rollout bucketing.
+	DeviceID string
+	// DefaultChannel is a channel configured in the app. It's used when the device has no channel assignment.
+	// If it's empty too, the default channel of the registered app is used.
+	DefaultChannel string
+
+	// channel is a resolved channel name, either from the device assignment or the default channel.
+	channel string
 }
 
 func (c GetLatestQuery) IsValid() bool {
@@ -111,12 +200,15 @@ func (c GetLatestQuery) IsValid() bool {
 }
 
 func (c GetLatestQuery) cacheKey() string {
-	return fmt.Sprintf("%s|%s|%s|%s", c.Platform, c.VersionName, c.VersionCode, c.AppID)
+	return fmt.Sprintf("release|%s|%s|%s|%s", c.Platform, c.VersionName, c.VersionCode, c.AppID)
 }
 
 type GetLatestResult struct {
 	Bundle  db.Bundle
 	Builtin bool
+
+	// BreakingChange is set when the release is superseded by a newer native version. Bundle is empty in this case.
+	BreakingChange *db.ReleaseSupersede
 }
 
 func (r GetLatestResult) VersionName() string {
@@ -127,14 +219,32 @@ func (r GetLatestResult) VersionName() string {
 	}
 }
 
-func (r GetLatestResult) Checksum() string {
+// Checksum returns the bundle checksum in the format verified by the plugin version: SHA-256 since
+// SHA256ChecksumMinPluginVersion, otherwise CRC32. CRC32 is returned as well if SHA-256 of the bundle is unknown.
+func (r GetLatestResult) Checksum(pluginVersion string) string {
+	if r.Bundle.SHA256Checksum != "" && supportsSHA256Checksum(pluginVersion) {
+		return r.Bundle.SHA256Checksum
+	}
 	return r.Bundle.CRC
 }
 
-func (r GetLatestResult) PublicDownloadURL() string {
-	return r.Bundle.PublicDownloadURL
+func supportsSHA256Checksum(pluginVersion string) bool {
+	v, err := semver.Parse(pluginVersion)
+	if err != nil {
+		return false
+	}
+	minVersion, err := semver.Parse(config.Get().SHA256ChecksumMinPluginVersion)
+	if err != nil {
+		slog.Warn("Invalid SHA-256 checksum minimum plugin version", "error", err)
+		return false
+	}
+	return !v.LessThan(minVersion)
 }
 
 func (r GetLatestResult) Signature() string {
 	return r.Bundle.Signature
 }
+
+func (r GetLatestResult) SessionKey() string {
+	return r.Bundle.Encryption.SessionKey()
+}
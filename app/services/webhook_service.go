@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	WebhookSignatureHeader = "X-Capgo-Signature"
+	WebhookTimestampHeader = "X-Capgo-Timestamp"
+	WebhookEventHeader     = "X-Capgo-Event"
+	WebhookDeliveryHeader  = "X-Capgo-Delivery"
+
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// webhookLease is how long a claimed delivery is hidden from other workers while it's being sent.
+	webhookLease = 2 * time.Minute
+)
+
+// webhookNotify wakes the worker up when a delivery is queued, so deliveries don't wait for the next poll.
+var webhookNotify = make(chan struct{}, 1)
+
+type WebhookService struct {
+}
+
+// WebhookPayload is the JSON body of every webhook request.
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Event     db.WebhookEvent `json:"event"`
+	AppID     string          `json:"app_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      interface{}     `json:"data"`
+}
+
+type WebhookBundleData struct {
+	BundleID    string `json:"bundle_id"`
+	VersionName string `json:"version_name"`
+}
+
+type WebhookReleaseData struct {
+	ReleaseID              string  `json:"release_id"`
+	Platform               string  `json:"platform"`
+	VersionName            string  `json:"version_name"`
+	VersionCode            string  `json:"version_code"`
+	ActiveBundleID         *string `json:"active_bundle_id"`
+	PreviousActiveBundleID *string `json:"previous_active_bundle_id,omitempty"`
+	RolloutBundleID        *string `json:"rollout_bundle_id,omitempty"`
+	RolloutPercentage      *int    `json:"rollout_percentage,omitempty"`
+	Reason                 string  `json:"reason,omitempty"`
+}
+
+func NewWebhookBundleData(bundle db.Bundle) WebhookBundleData {
+	return WebhookBundleData{
+		BundleID:    bundle.ID.Hex(),
+		VersionName: bundle.VersionName,
+	}
+}
+
+func NewWebhookReleaseData(release db.Release) WebhookReleaseData {
+	data := WebhookReleaseData{
+		ReleaseID:   release.ID.Hex(),
+		Platform:    string(release.Platform),
+		VersionName: release.VersionName,
+		VersionCode: release.VersionCode,
+	}
+	if release.ActiveBundleID != nil {
+		s := release.ActiveBundleID.Hex()
+		data.ActiveBundleID = &s
+	}
+	if release.PreviousActiveBundleID != nil {
+		s := release.PreviousActiveBundleID.Hex()
+		data.PreviousActiveBundleID = &s
+	}
+	if release.Rollout != nil {
+		s := release.Rollout.BundleID.Hex()
+		data.RolloutBundleID = &s
+		data.RolloutPercentage = &release.Rollout.Percentage
+	}
+	return data
+}
+
+// Dispatch queues a delivery of the event to every enabled webhook of the app that subscribes to it. Deliveries are sent
+// by the webhook worker. Errors are only logged, as the change that caused the event is already saved.
+func (svc *WebhookService) Dispatch(ctx context.Context, appID string, event db.WebhookEvent, data interface{}) {
+	if err := svc.dispatch(ctx, appID, event, data); err != nil {
+		slog.Error("Failed to queue webhook deliveries", "error", err, "app_id", appID, "event", event)
+	}
+}
+
+func (svc *WebhookService) dispatch(ctx context.Context, appID string, event db.WebhookEvent, data interface{}) error {
+	cursor, err := db.Collections().Webhooks().Find(ctx, bson.M{"app_id": appID, "enabled": true})
+	if err != nil {
+		return fmt.Errorf("fetch webhooks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []db.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return fmt.Errorf("decode webhooks: %w", err)
+	}
+
+	now := time.Now()
+	var deliveries []interface{}
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+
+		id := primitive.NewObjectID()
+		payload, err := json.Marshal(WebhookPayload{
+			ID:        id.Hex(),
+			Event:     event,
+			AppID:     appID,
+			CreatedAt: now,
+			Data:      data,
+		})
+		if err != nil {
+			return fmt.Errorf("encode payload: %w", err)
+		}
+
+		deliveries = append(deliveries, db.WebhookDelivery{
+			ID:            id,
+			WebhookID:     webhook.ID,
+			AppID:         appID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        db.WebhookDeliveryStatusPending,
+			NextAttemptAt: now,
+			UpdatedAt:     now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if _, err := db.Collections().WebhookDeliveries().InsertMany(ctx, deliveries); err != nil {
+		return fmt.Errorf("insert deliveries: %w", err)
+	}
+
+	select {
+	case webhookNotify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Redeliver queues a finished delivery again with a fresh attempt count.
+func (svc *WebhookService) Redeliver(ctx context.Context, deliveryID primitive.ObjectID) error {
+	result, err := db.Collections().WebhookDeliveries().UpdateOne(ctx, bson.M{"_id": deliveryID}, bson.M{
+		"$set": bson.M{
+			"status":          db.WebhookDeliveryStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"updated_at":      time.Now(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+
+	select {
+	case webhookNotify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// GenerateWebhookSecret returns a random secret for signing payloads.
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload returns the signature header value of a payload. The signature is a hex encoded HMAC-SHA256 of
+// "{timestamp}.{payload}", so receivers can reject replayed requests by checking the timestamp.
+func SignWebhookPayload(secret string, timestamp int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookBackoff is the delay before the next attempt after the given number of failed attempts.
+func WebhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, webhookMaxBackoff)
+}
+
+// StartWebhookWorker sends queued webhook deliveries, and retries failed ones with exponential backoff until
+// WEBHOOK_MAX_ATTEMPTS is reached. Deliveries are leased, so multiple replicas can run the worker.
+// Calling the returned stop function waits for the in-flight delivery and the worker to exit.
+func StartWebhookWorker() (stop func()) {
+	interval := config.Get().WebhookPollInterval
+	if interval <= 0 {
+		slog.Info("Webhook worker is disabled")
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &http.Client{Timeout: config.Get().WebhookTimeout}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := deliverDueWebhooks(ctx, client); err != nil {
+				slog.Error("Failed to deliver webhooks", "error", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-webhookNotify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func deliverDueWebhooks(ctx context.Context, client *http.Client) error {
+	for ctx.Err() == nil {
+		now := time.Now()
+		var delivery db.WebhookDelivery
+		err := db.Collections().WebhookDeliveries().FindOneAndUpdate(
+			ctx,
+			bson.M{
+				"status":          db.WebhookDeliveryStatusPending,
+				"next_attempt_at": bson.M{"$lte": now},
+			},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(webhookLease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(options.After),
+		).Decode(&delivery)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil
+			}
+			return fmt.Errorf("claim delivery: %w", err)
+		}
+
+		if err := deliverWebhook(ctx, client, delivery); err != nil {
+			slog.Error("Failed to save webhook delivery", "error", err, "delivery", delivery.ID.Hex())
+		}
+	}
+	return nil
+}
+
+func deliverWebhook(ctx context.Context, client *http.Client, delivery db.WebhookDelivery) error {
+	var webhook db.Webhook
+	err := db.Collections().Webhooks().FindOne(ctx, bson.M{"_id": delivery.WebhookID}).Decode(&webhook)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("find webhook: %w", err)
+	}
+
+	now := time.Now()
+	set := bson.M{
+		"last_attempt_at": now,
+		"updated_at":      now,
+	}
+	if err != nil || !webhook.Enabled {
+		set["status"] = db.WebhookDeliveryStatusFailed
+		set["last_error"] = "webhook is deleted or disabled"
+	} else {
+		statusCode, sendErr := sendWebhook(ctx, client, webhook, delivery)
+		delivery.Attempts++
+		set["attempts"] = delivery.Attempts
+		set["last_status_code"] = statusCode
+		set["last_error"] = ""
+
+		switch {
+		case sendErr == nil:
+			set["status"] = db.WebhookDeliveryStatusSucceeded
+		case delivery.Attempts >= config.Get().WebhookMaxAttempts:
+			set["status"] = db.WebhookDeliveryStatusFailed
+			set["last_error"] = sendErr.Error()
+		default:
+			set["next_attempt_at"] = now.Add(WebhookBackoff(delivery.Attempts))
+			set["last_error"] = sendErr.Error()
+		}
+		if sendErr != nil {
+			slog.Info("Webhook delivery failed", "error", sendErr, "delivery", delivery.ID.Hex(), "attempts", delivery.Attempts)
+		}
+	}
+
+	_, err = db.Collections().WebhookDeliveries().UpdateOne(context.WithoutCancel(ctx), bson.M{"_id": delivery.ID}, bson.M{"$set": set})
+	return err
+}
+
+// sendWebhook posts the payload and returns the response status code. Any non-2xx response is an error.
+func sendWebhook(ctx context.Context, client *http.Client, webhook db.Webhook, delivery db.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "capgo-server-webhook")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
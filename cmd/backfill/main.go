@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/app/services"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report computed checksums without saving them")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Connecting to database...")
+	if err := db.InitDB(ctx); err != nil {
+		slog.Error("Error init db", "error", err)
+		os.Exit(1)
+	}
+
+	if _, err := storage.Default(); err != nil {
+		slog.Error("Error init bundle storage", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Backfilling bundle checksums...", "dry_run", *dryRun)
+	report, err := services.BackfillBundleIntegrity(ctx, *dryRun)
+	if err != nil {
+		slog.Error("Error backfilling bundle checksums", "error", err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		slog.Error("Error writing report", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Backfill done", "updated", len(report.Updated), "failed", len(report.Failed))
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
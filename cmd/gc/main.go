@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/app/services"
+	"github.com/tanapoln/capgo-server/config"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report bundles and objects that would be cleaned up")
+	orphanGrace := flag.Duration("orphan-grace", config.Get().BundleGCOrphanGrace, "minimum age of a stored object without a bundle before it's deleted")
+	sweepBucket := flag.Bool("sweep-bucket", config.Get().BundleGCSweepBucket, "delete every stored object without a bundle, not only objects of the bundle key layout")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Connecting to database...")
+	if err := db.InitDB(ctx); err != nil {
+		slog.Error("Error init db", "error", err)
+		os.Exit(1)
+	}
+
+	if _, err := storage.Default(); err != nil {
+		slog.Error("Error init bundle storage", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Running bundle garbage collection...", "dry_run", *dryRun)
+	report, err := services.RunBundleGC(ctx, services.BundleGCOptions{
+		DryRun:      *dryRun,
+		OrphanGrace: *orphanGrace,
+		SweepBucket: *sweepBucket,
+	})
+	if err != nil {
+		slog.Error("Error running bundle garbage collection", "error", err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		slog.Error("Error writing report", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Bundle garbage collection done")
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"time"
 
 	"github.com/tanapoln/capgo-server/app"
+	"github.com/tanapoln/capgo-server/app/controllers/utils/middlewares/authn"
 	"github.com/tanapoln/capgo-server/app/db"
+	"github.com/tanapoln/capgo-server/app/external/storage"
+	"github.com/tanapoln/capgo-server/app/services"
 	"github.com/tanapoln/capgo-server/cmd/server/otel"
 	"github.com/tanapoln/capgo-server/config"
 )
@@ -26,6 +29,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if _, err := storage.Default(); err != nil {
+		slog.Error("Error init bundle storage", "error", err)
+		os.Exit(1)
+	}
+
 	shutdownOtel, err := otel.SetupOTelSDK(ctx)
 	if err != nil {
 		slog.Error("Error setup otel", "error", err)
@@ -33,6 +41,14 @@ func main() {
 	}
 	defer shutdownOtel(context.Background())
 
+	stopStatsWriter := services.StartStatsWriter()
+	stopAutoRollbackWatcher := services.StartAutoRollbackWatcher()
+	stopCacheInvalidationListener := services.StartCacheInvalidationListener()
+	stopOIDCProvider := authn.StartOIDCProvider()
+	stopWebhookWorker := services.StartWebhookWorker()
+	stopBundlePurger := services.StartBundlePurger()
+	stopBundleGC := services.StartBundleGC()
+
 	userSrv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.Get().CapgoUserPort),
 		Handler: app.InitRouter(),
@@ -71,5 +87,15 @@ func main() {
 		slog.Error("Server forced to shutdown", "error", err)
 	}
 
+	stopAutoRollbackWatcher()
+	stopCacheInvalidationListener()
+	stopOIDCProvider()
+	stopWebhookWorker()
+	stopBundlePurger()
+	stopBundleGC()
+
+	slog.Info("Flushing stats events...")
+	stopStatsWriter()
+
 	slog.Info("Server exiting")
 }
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"log/slog"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -12,34 +15,111 @@ type Config struct {
 	MongoConnectionString string        `yaml:"mongo_connection_string" env:"MONGO_CONNECTION_STRING" env-default:"mongodb://localhost:27017"`
 	MongoDatabase         string        `yaml:"mongo_database" env:"MONGO_DATABASE" env-default:"capgo"`
 	S3BaseEndpoint        string        `yaml:"s3_base_endpoint" env:"S3_BASE_ENDPOINT"`
-	S3Bucket              string        `yaml:"s3_bucket" env:"S3_BUCKET" env-required:"true"`
+	S3Bucket              string        `yaml:"s3_bucket" env:"S3_BUCKET"`
 	ManagementAPITokens   []string      `yaml:"management_api_tokens" env:"MANAGEMENT_API_TOKENS" env-required:"true"`
 	LimitRequestPerMinute int           `yaml:"limit_request_per_minute" env:"LIMIT_REQUEST_PER_MINUTE" env-default:"100"`
 	TrustedProxies        []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
 	CacheResultDuration   time.Duration `yaml:"cache_result_duration" env:"CACHE_RESULT_DURATION" env-default:"10m"`
+	CacheErrorDuration    time.Duration `yaml:"cache_error_duration" env:"CACHE_ERROR_DURATION" env-default:"1m"`
+	CachePollInterval     time.Duration `yaml:"cache_poll_interval" env:"CACHE_POLL_INTERVAL" env-default:"2s"`
+	DeviceChannelCacheTTL time.Duration `yaml:"device_channel_cache_ttl" env:"DEVICE_CHANNEL_CACHE_TTL" env-default:"30s"`
 	OAuthIssuer           string        `yaml:"oauth_issuer" env:"OAUTH_ISSUER"`
 	OAuthClientID         string        `yaml:"oauth_client_id" env:"OAUTH_CLIENT_ID"`
+	OAuthRoleClaim        string        `yaml:"oauth_role_claim" env:"OAUTH_ROLE_CLAIM" env-default:"groups"`
+	OAuthDefaultRole      string        `yaml:"oauth_default_role" env:"OAUTH_DEFAULT_ROLE"`
+	OAuthRefreshInterval  time.Duration `yaml:"oauth_refresh_interval" env:"OAUTH_REFRESH_INTERVAL" env-default:"1h"`
+	OAuthUserInfoFallback bool          `yaml:"oauth_userinfo_fallback" env:"OAUTH_USERINFO_FALLBACK" env-default:"true"`
 	CapgoUserPort         int           `yaml:"capgo_user_port" env:"CAPGO_USER_PORT" env-default:"8000"`
 	CapgoManagementPort   int           `yaml:"capgo_management_port" env:"CAPGO_MANAGEMENT_PORT" env-default:"8001"`
+	StatsRetention        time.Duration `yaml:"stats_retention" env:"STATS_RETENTION" env-default:"720h"`
+	StatsBatchSize        int           `yaml:"stats_batch_size" env:"STATS_BATCH_SIZE" env-default:"100"`
+	StatsFlushInterval    time.Duration `yaml:"stats_flush_interval" env:"STATS_FLUSH_INTERVAL" env-default:"5s"`
+	StatsQueueSize        int           `yaml:"stats_queue_size" env:"STATS_QUEUE_SIZE" env-default:"10000"`
+	AutoRollbackInterval  time.Duration `yaml:"auto_rollback_interval" env:"AUTO_ROLLBACK_INTERVAL" env-default:"1m"`
+
+	// WebhookPollInterval is how often the webhook worker checks for due deliveries. Zero disables the worker.
+	WebhookPollInterval      time.Duration `yaml:"webhook_poll_interval" env:"WEBHOOK_POLL_INTERVAL" env-default:"5s"`
+	WebhookTimeout           time.Duration `yaml:"webhook_timeout" env:"WEBHOOK_TIMEOUT" env-default:"10s"`
+	WebhookMaxAttempts       int           `yaml:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" env-default:"8"`
+	WebhookDeliveryRetention time.Duration `yaml:"webhook_delivery_retention" env:"WEBHOOK_DELIVERY_RETENTION" env-default:"720h"`
+
+	// BundleDeleteRetention is how long a deleted bundle can be restored before it's purged.
+	BundleDeleteRetention time.Duration `yaml:"bundle_delete_retention" env:"BUNDLE_DELETE_RETENTION" env-default:"168h"`
+	// BundlePurgeInterval is how often deleted bundles are checked for purging. Zero disables the purger.
+	BundlePurgeInterval time.Duration `yaml:"bundle_purge_interval" env:"BUNDLE_PURGE_INTERVAL" env-default:"1h"`
+	// BundleGCInterval is how often retention policies and orphaned object cleanup are applied. Zero disables the job,
+	// so it's only applied by running cmd/gc.
+	BundleGCInterval time.Duration `yaml:"bundle_gc_interval" env:"BUNDLE_GC_INTERVAL" env-default:"0"`
+	// BundleGCOrphanGrace is how old a stored object without a bundle must be before it's deleted. Uploads store the object
+	// before the bundle, so recent objects may belong to uploads in progress.
+	BundleGCOrphanGrace time.Duration `yaml:"bundle_gc_orphan_grace" env:"BUNDLE_GC_ORPHAN_GRACE" env-default:"24h"`
+	// BundleGCSweepBucket deletes every stored object without a bundle, not only objects of the bundle key layout.
+	// Only enable it if the bucket is dedicated to capgo-server.
+	BundleGCSweepBucket bool `yaml:"bundle_gc_sweep_bucket" env:"BUNDLE_GC_SWEEP_BUCKET" env-default:"false"`
+
+	// OAuthClaimRoles maps a value of the role claim to a role, e.g. capgo-admins:admin,capgo-devs:developer.
+	OAuthClaimRoles map[string]string `yaml:"oauth_claim_roles" env:"OAUTH_CLAIM_ROLES"`
+	// OAuthDomainRoles maps a domain of a verified email to a role, e.g. example.com:viewer.
+	OAuthDomainRoles map[string]string `yaml:"oauth_domain_roles" env:"OAUTH_DOMAIN_ROLES"`
+
+	// StorageBackend is where bundle zip files are stored. One of s3 or local.
+	StorageBackend  string `yaml:"storage_backend" env:"STORAGE_BACKEND" env-default:"s3"`
+	LocalStorageDir string `yaml:"local_storage_dir" env:"LOCAL_STORAGE_DIR" env-default:"./data/bundles"`
+
+	// BundleDownloadURLMode is how bundle download urls are generated for devices. One of presigned, signed or public.
+	// presigned: a short-lived S3 presigned url. signed: a short-lived HMAC-signed url served by the user server.
+	// public: bundles are uploaded as public objects and the object url is used as-is.
+	BundleDownloadURLMode   string        `yaml:"bundle_download_url_mode" env:"BUNDLE_DOWNLOAD_URL_MODE" env-default:"presigned"`
+	BundleDownloadURLTTL    time.Duration `yaml:"bundle_download_url_ttl" env:"BUNDLE_DOWNLOAD_URL_TTL" env-default:"15m"`
+	BundleDownloadURLSecret string        `yaml:"bundle_download_url_secret" env:"BUNDLE_DOWNLOAD_URL_SECRET"`
+	// PublicBaseURL is an externally reachable base url of the user server, e.g. https://capgo.example.com. Required for signed mode.
+	PublicBaseURL string `yaml:"public_base_url" env:"PUBLIC_BASE_URL"`
+
+	// BundleSigningPrivateKey is a PEM encoded RSA or Ed25519 private key (or a path to it) for signing uploaded bundles.
+	// The matching public key must be configured in the app. Bundles are not signed if empty.
+	BundleSigningPrivateKey string `yaml:"bundle_signing_private_key" env:"BUNDLE_SIGNING_PRIVATE_KEY"`
+	// BundleEncryptionPrivateKey is a PEM encoded RSA private key (or a path to it) for encrypting uploaded bundles.
+	// The matching public key must be configured in the app. Bundles are not encrypted if empty.
+	BundleEncryptionPrivateKey string `yaml:"bundle_encryption_private_key" env:"BUNDLE_ENCRYPTION_PRIVATE_KEY"`
+	// BundleMaxSize and BundleMaxUncompressedSize limit the size of an uploaded bundle zip file and the total size of its
+	// files in bytes. BundleMaxFiles limits the number of files. Zero disables a limit.
+	BundleMaxSize             int64 `yaml:"bundle_max_size" env:"BUNDLE_MAX_SIZE" env-default:"104857600"`
+	BundleMaxUncompressedSize int64 `yaml:"bundle_max_uncompressed_size" env:"BUNDLE_MAX_UNCOMPRESSED_SIZE" env-default:"524288000"`
+	BundleMaxFiles            int   `yaml:"bundle_max_files" env:"BUNDLE_MAX_FILES" env-default:"10000"`
+	// BundleRequireIndexHTML rejects uploaded bundles without index.html at the root of the zip file.
+	BundleRequireIndexHTML bool `yaml:"bundle_require_index_html" env:"BUNDLE_REQUIRE_INDEX_HTML" env-default:"true"`
+	// BundleSourceMaps is how source maps (.map files) in uploaded bundles are handled. One of warn, reject or allow.
+	BundleSourceMaps string `yaml:"bundle_source_maps" env:"BUNDLE_SOURCE_MAPS" env-default:"warn"`
+
+	// SHA256ChecksumMinPluginVersion is the lowest Capgo plugin version that receives SHA-256 bundle checksums.
+	// Older plugins, and plugins not reporting their version, receive CRC32 checksums.
+	SHA256ChecksumMinPluginVersion string `yaml:"sha256_checksum_min_plugin_version" env:"SHA256_CHECKSUM_MIN_PLUGIN_VERSION" env-default:"7.0.0"`
 }
 
+const configFile = "config.yml"
+
 var (
-	cfg *Config
+	cfg      = &Config{}
+	loadOnce sync.Once
 )
 
-func init() {
-	cfg = &Config{}
-	err := Reload()
-	if err != nil {
-		slog.Error("Config error", "error", err)
-		os.Exit(1)
-	}
-}
-
+// Get returns the config, which is loaded on first use.
 func Get() Config {
+	loadOnce.Do(func() {
+		err := Reload()
+		if err != nil {
+			slog.Error("Config error", "error", err)
+			os.Exit(1)
+		}
+	})
 	return *cfg
 }
 
+// Reload reads config.yml of the working directory and environment variables, or only environment variables if there's
+// no config.yml.
 func Reload() error {
-	return cleanenv.ReadConfig("config.yml", cfg)
+	if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) {
+		return cleanenv.ReadEnv(cfg)
+	}
+	return cleanenv.ReadConfig(configFile, cfg)
 }